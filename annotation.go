@@ -0,0 +1,182 @@
+package opentsdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+)
+
+type Annotation struct {
+	// Required
+	// Unix time the annotation starts at
+	StartTime int64 `json:"startTime"`
+
+	// Unix time the annotation ends at, 0 if it's a single point in time
+	EndTime int64 `json:"endTime,omitempty"`
+
+	// Time series the annotation is attached to, empty for a global annotation
+	TSUID string `json:"tsuid,omitempty"`
+
+	Description string            `json:"description,omitempty"`
+	Notes       string            `json:"notes,omitempty"`
+	Custom      map[string]string `json:"custom,omitempty"`
+}
+
+// GetAnnotation fetches the annotation starting at startTime on the given
+// time series. An empty tsuid fetches the global annotation.
+func (c *Client) GetAnnotation(startTime int64, tsuid string) (*Annotation, error) {
+	return c.GetAnnotationContext(context.Background(), startTime, tsuid)
+}
+
+func (c *Client) GetAnnotationContext(ctx context.Context, startTime int64, tsuid string) (*Annotation, error) {
+
+	params := url.Values{}
+	params.Set("start_time", strconv.FormatInt(startTime, 10))
+	if tsuid != "" {
+		params.Set("tsuid", tsuid)
+	}
+
+	body, err := c.execRequest(ctx, "GET", "api/annotation", params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Annotation{}
+	if err := json.Unmarshal(body, a); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+
+}
+
+// SetAnnotation creates the annotation or updates the one already stored for
+// the same start time and TSUID, returning the stored record.
+func (c *Client) SetAnnotation(a *Annotation) (*Annotation, error) {
+	return c.SetAnnotationContext(context.Background(), a)
+}
+
+func (c *Client) SetAnnotationContext(ctx context.Context, a *Annotation) (*Annotation, error) {
+	if a.StartTime == 0 {
+		return nil, errors.New("AnnotationError: StartTime can not be empty")
+	}
+
+	data, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := c.ExecRequestContext(ctx, "POST", "api/annotation", data)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := &Annotation{}
+	if err := json.Unmarshal(body, stored); err != nil {
+		return nil, err
+	}
+
+	return stored, nil
+
+}
+
+// DeleteAnnotation removes the annotation matching StartTime and TSUID. If
+// there is no such annotation the returned error wraps ErrNotFound, so
+// callers can ignore it with errors.Is to make deletes idempotent.
+func (c *Client) DeleteAnnotation(a *Annotation) error {
+	return c.DeleteAnnotationContext(context.Background(), a)
+}
+
+func (c *Client) DeleteAnnotationContext(ctx context.Context, a *Annotation) error {
+	if a.StartTime == 0 {
+		return errors.New("AnnotationError: StartTime can not be empty")
+	}
+
+	data, err := json.Marshal(Annotation{StartTime: a.StartTime, TSUID: a.TSUID})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.ExecRequestContext(ctx, "DELETE", "api/annotation", data)
+	return err
+}
+
+func (c *Client) SetAnnotations(annotations []Annotation) ([]Annotation, error) {
+	return c.SetAnnotationsContext(context.Background(), annotations)
+}
+
+func (c *Client) SetAnnotationsContext(ctx context.Context, annotations []Annotation) ([]Annotation, error) {
+	for _, a := range annotations {
+		if a.StartTime == 0 {
+			return nil, errors.New("AnnotationError: StartTime can not be empty")
+		}
+	}
+
+	data, err := json.Marshal(annotations)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := c.ExecRequestContext(ctx, "POST", "api/annotation/bulk", data)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := make([]Annotation, 0)
+	if err := json.Unmarshal(body, &stored); err != nil {
+		return nil, err
+	}
+
+	return stored, nil
+
+}
+
+type annotationBulkDelete struct {
+	StartTime    int64    `json:"startTime"`
+	EndTime      int64    `json:"endTime,omitempty"`
+	TSUIDs       []string `json:"tsuids,omitempty"`
+	Global       bool     `json:"global"`
+	TotalDeleted int      `json:"totalDeleted,omitempty"`
+}
+
+// DeleteAnnotationsInRange removes the annotations of the given time series
+// between startTime and endTime, and the global ones too when global is set.
+// An endTime of 0 means up to now. It returns the number of deleted
+// annotations and requires OpenTSDB 2.2 or later.
+func (c *Client) DeleteAnnotationsInRange(startTime, endTime int64, tsuids []string, global bool) (int, error) {
+	return c.DeleteAnnotationsInRangeContext(context.Background(), startTime, endTime, tsuids, global)
+}
+
+func (c *Client) DeleteAnnotationsInRangeContext(ctx context.Context, startTime, endTime int64, tsuids []string, global bool) (int, error) {
+	if startTime == 0 {
+		return 0, errors.New("AnnotationError: StartTime can not be empty")
+	}
+	if len(tsuids) == 0 && !global {
+		return 0, errors.New("AnnotationError: tsuids can not be empty for non global deletes")
+	}
+
+	data, err := json.Marshal(annotationBulkDelete{
+		StartTime: startTime,
+		EndTime:   endTime,
+		TSUIDs:    tsuids,
+		Global:    global,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	body, err := c.ExecRequestContext(ctx, "DELETE", "api/annotation/bulk", data)
+	if err != nil {
+		return 0, err
+	}
+
+	result := annotationBulkDelete{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return 0, err
+	}
+
+	return result.TotalDeleted, nil
+
+}
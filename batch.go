@@ -0,0 +1,71 @@
+package opentsdb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// BatchQueryResult is the outcome of one of the queries of QueryBatch
+type BatchQueryResult struct {
+	// Position of the query in the queries given to QueryBatch
+	Index int
+
+	Results []QueryResult
+
+	// Error of the query, nil when it succeeded
+	Err error
+}
+
+// QueryBatch runs independent queries with at most concurrency of them in
+// flight, a concurrency of 0 or less runs them one at a time. The returned
+// results are in the order of queries. With failFast the queries not done
+// yet are canceled on the first failure. The error is non-nil when any
+// query failed.
+func (c *Client) QueryBatch(ctx context.Context, queries []*QueryParams, concurrency int, failFast bool) ([]BatchQueryResult, error) {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	if concurrency > len(queries) {
+		concurrency = len(queries)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]BatchQueryResult, len(queries))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				res, err := c.QueryTypedContext(ctx, queries[i])
+				results[i] = BatchQueryResult{Index: i, Results: res, Err: err}
+				if err != nil && failFast {
+					cancel()
+				}
+			}
+		}()
+	}
+
+	for i := range queries {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return results, fmt.Errorf("QueryError: %d of %d queries failed", failed, len(results))
+	}
+
+	return results, nil
+}
@@ -0,0 +1,173 @@
+package opentsdb
+
+import (
+	"errors"
+	"fmt"
+)
+
+// QueryBuilder assembles a QueryParams step by step, e.g.:
+//
+//	q, err := NewQuery().Start("1h-ago").
+//		AddMetric("sum", "sys.cpu.user").WithTags(map[string]string{"host": "*"}).
+//		AddMetric("avg", "sys.cpu.idle").WithDownsample("1m-avg").
+//		Build()
+//
+// The With methods apply to the metric added last.
+type QueryBuilder struct {
+	params QueryParams
+	err    error
+}
+
+func NewQuery() *QueryBuilder {
+	return &QueryBuilder{}
+}
+
+// Start sets the start time, a relative string such as "1h-ago" or a unix
+// timestamp
+func (b *QueryBuilder) Start(t interface{}) *QueryBuilder {
+	b.params.Start = t
+	return b
+}
+
+// End sets the end time, a relative string or a unix timestamp
+func (b *QueryBuilder) End(t interface{}) *QueryBuilder {
+	b.params.End = t
+	return b
+}
+
+// AddMetric adds a sub-query for metric aggregated with aggregator
+func (b *QueryBuilder) AddMetric(aggregator string, metric string) *QueryBuilder {
+	if aggregator == "" || metric == "" {
+		b.setErr(errors.New("QueryError: aggregator and metric can not be empty"))
+	}
+	b.params.Queries = append(b.params.Queries, Query{Aggregator: aggregator, Metric: metric})
+	return b
+}
+
+// AddTSUIDs adds a sub-query for the series with the given TSUIDs, e.g. from
+// SearchLookup, aggregated with aggregator
+func (b *QueryBuilder) AddTSUIDs(aggregator string, tsuids ...string) *QueryBuilder {
+	if aggregator == "" || len(tsuids) == 0 {
+		b.setErr(errors.New("QueryError: aggregator and TSUIDs can not be empty"))
+	}
+	b.params.Queries = append(b.params.Queries, Query{Aggregator: aggregator, TSUIDs: tsuids})
+	return b
+}
+
+func (b *QueryBuilder) WithTags(tags map[string]string) *QueryBuilder {
+	if q := b.last(); q != nil {
+		q.Tags = tags
+	}
+	return b
+}
+
+// WithDownsample sets a downsampling specification such as "1m-avg"
+func (b *QueryBuilder) WithDownsample(downsample string) *QueryBuilder {
+	if q := b.last(); q != nil {
+		q.Downsample = downsample
+	}
+	return b
+}
+
+// Downsample sets the downsampling of the metric from its parts, e.g.
+// Downsample("1m", "avg", "zero") gives "1m-avg-zero". The fill policy is one
+// of none, nan, null or zero, or empty to leave it to the server.
+func (b *QueryBuilder) Downsample(interval, aggregator, fillPolicy string) *QueryBuilder {
+	if interval == "" || aggregator == "" {
+		b.setErr(errors.New("QueryError: downsample interval and aggregator can not be empty"))
+		return b
+	}
+
+	downsample := interval + "-" + aggregator
+	switch fillPolicy {
+	case "":
+	case "none", "nan", "null", "zero":
+		downsample += "-" + fillPolicy
+	default:
+		b.setErr(fmt.Errorf("QueryError: fill policy must be one of none, nan, null or zero, got %q", fillPolicy))
+		return b
+	}
+
+	return b.WithDownsample(downsample)
+}
+
+func (b *QueryBuilder) WithRate() *QueryBuilder {
+	if q := b.last(); q != nil {
+		q.Rate = true
+	}
+	return b
+}
+
+// WithExplicitTags only matches series with exactly the tag keys given for
+// the last metric
+func (b *QueryBuilder) WithExplicitTags() *QueryBuilder {
+	if q := b.last(); q != nil {
+		q.ExplicitTags = true
+	}
+	return b
+}
+
+// WithRollupUsage sets how the last metric reads rollup tables, one of the
+// RollupUsage constants
+func (b *QueryBuilder) WithRollupUsage(usage string) *QueryBuilder {
+	if err := validateRollupUsage(usage); err != nil {
+		b.setErr(err)
+		return b
+	}
+	if q := b.last(); q != nil {
+		q.RollupUsage = usage
+	}
+	return b
+}
+
+// WithRateOptions converts the metric to a rate with the given counter
+// handling
+func (b *QueryBuilder) WithRateOptions(opts RateOptions) *QueryBuilder {
+	if q := b.last(); q != nil {
+		q.Rate = true
+		q.RateOptions = &opts
+	}
+	return b
+}
+
+func (b *QueryBuilder) WithFilter(f Filter) *QueryBuilder {
+	if q := b.last(); q != nil {
+		q.Filters = append(q.Filters, f)
+	}
+	return b
+}
+
+// Build returns the query or the first error met while building it
+func (b *QueryBuilder) Build() (*QueryParams, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if b.params.Start == nil || b.params.Start == "" {
+		return nil, errors.New("QueryError: Start can not be empty")
+	}
+	if len(b.params.Queries) == 0 {
+		return nil, errors.New("QueryError: at least one metric is required")
+	}
+	if err := b.params.validate(); err != nil {
+		return nil, err
+	}
+
+	params := b.params
+	params.Queries = append([]Query(nil), b.params.Queries...)
+	return &params, nil
+}
+
+// last returns the sub-query the With methods apply to
+func (b *QueryBuilder) last() *Query {
+	if len(b.params.Queries) == 0 {
+		b.setErr(errors.New("QueryError: AddMetric must be called before setting sub-query options"))
+		return nil
+	}
+	return &b.params.Queries[len(b.params.Queries)-1]
+}
+
+func (b *QueryBuilder) setErr(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
@@ -0,0 +1,110 @@
+package opentsdb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cache stores the bodies of Query responses, see Options.Cache.
+// Implementations must be safe for concurrent use. Keys cover the endpoints,
+// credentials and headers of the client, so a Cache can be shared by
+// clients of different servers or tenants.
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, val []byte, ttl time.Duration)
+}
+
+// Layouts of the absolute dates OpenTSDB accepts in queries
+var absoluteTimeLayouts = []string{
+	"2006/01/02-15:04:05",
+	"2006/01/02-15:04",
+	"2006/01/02",
+}
+
+// queryCacheKey returns the cache key of a marshaled query sent by a client
+// with the given scope, and false when the query can't be cached because its
+// time range isn't closed yet
+func queryCacheKey(scope string, q *QueryParams, data []byte) (string, bool) {
+	if q == nil || !inPast(q.End) {
+		return "", false
+	}
+
+	// Arrays changes the response but is sent in the URL
+	sum := sha256.Sum256([]byte(scope + "\n" + q.rawQuery() + "\n" + string(data)))
+	return "opentsdb:query:" + hex.EncodeToString(sum[:]), true
+}
+
+// cacheScope describes who the client queries and as whom: its endpoints,
+// credentials and headers, e.g. a tenant header
+func (c *Client) cacheScope() string {
+	var b strings.Builder
+	for _, e := range c.endpoints.endpoints {
+		b.WriteString(e.url.String() + "\n")
+	}
+
+	c.creds.mu.RLock()
+	defer c.creds.mu.RUnlock()
+
+	b.WriteString(c.creds.username + "\n" + c.creds.password + "\n" + c.creds.bearerToken + "\n")
+	keys := make([]string, 0, len(c.creds.headers))
+	for k := range c.creds.headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b.WriteString(k + ": " + c.creds.headers[k] + "\n")
+	}
+
+	return b.String()
+}
+
+// inPast reports whether end is an absolute time before now. Relative times
+// like "1h-ago" and a missing end, which means now, are never in the past
+// as they move with the clock.
+func inPast(end interface{}) bool {
+	now := time.Now()
+
+	var ts int64
+	switch v := end.(type) {
+	case int:
+		ts = int64(v)
+	case int64:
+		ts = v
+	case float64:
+		ts = int64(v)
+	case json.Number:
+		n, err := v.Int64()
+		if err != nil {
+			return false
+		}
+		ts = n
+	case time.Time:
+		return v.Before(now)
+	case string:
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			ts = n
+			break
+		}
+		for _, layout := range absoluteTimeLayouts {
+			if t, err := time.ParseInLocation(layout, v, time.Local); err == nil {
+				return t.Before(now)
+			}
+		}
+		return false
+	default:
+		return false
+	}
+
+	if ts <= 0 {
+		return false
+	}
+	if ts > maxSecondTimestamp {
+		return ts < now.UnixNano()/int64(time.Millisecond)
+	}
+	return ts < now.Unix()
+}
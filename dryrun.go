@@ -0,0 +1,58 @@
+package opentsdb
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// ErrDryRun is matched by the errors of calls made with Options.DryRun
+var ErrDryRun = errors.New("opentsdb: dry run")
+
+// PreparedRequest is a request as it would have been sent. With
+// Options.DryRun calls return it as their error, get it back with
+// errors.As.
+type PreparedRequest struct {
+	Method string
+	URL    string
+	Header http.Header
+	Body   []byte
+}
+
+func (r *PreparedRequest) Error() string {
+	return fmt.Sprintf("%s: %s %s", ErrDryRun, r.Method, r.URL)
+}
+
+func (r *PreparedRequest) Is(target error) bool {
+	return target == ErrDryRun
+}
+
+// prepare completes req for the next endpoint and reads it out instead of
+// sending it
+func (c *Client) prepare(req *http.Request) error {
+	e := c.endpoints.pick()
+	req.URL = e.requestURL(req.URL.Path, req.URL.RawQuery)
+	req.Host = req.URL.Host
+
+	if c.intercept != nil {
+		if err := c.intercept(req); err != nil {
+			return err
+		}
+	}
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return err
+		}
+	}
+
+	return &PreparedRequest{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Header: req.Header.Clone(),
+		Body:   body,
+	}
+}
@@ -0,0 +1,94 @@
+package opentsdb
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+type endpoint struct {
+	url *url.URL
+
+	// Set when a request failed, the endpoint is skipped until then
+	quarantinedUntil time.Time
+}
+
+// requestURL builds the URL of an API call on a copy of the endpoint, the
+// endpoint's URL is shared by concurrent requests and must not be modified.
+// The API path is joined to the endpoint's base path, so a TSD behind a
+// proxy prefix such as http://host/opentsdb/ works.
+func (e *endpoint) requestURL(path string, rawQuery string) *url.URL {
+	u := *e.url
+	u.Path = joinPath(u.Path, path)
+	u.RawPath = ""
+	u.RawQuery = rawQuery
+	return &u
+}
+
+// joinPath joins base and p with a single slash and collapses repeated
+// slashes
+func joinPath(base string, p string) string {
+	joined := strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(p, "/")
+	for strings.Contains(joined, "//") {
+		joined = strings.ReplaceAll(joined, "//", "/")
+	}
+	return joined
+}
+
+// endpointPool hands out endpoints round-robin, skipping the ones that
+// failed recently
+type endpointPool struct {
+	mu        sync.Mutex
+	endpoints []*endpoint
+	next      int
+	cooldown  time.Duration
+}
+
+func newEndpointPool(addrs []string, cooldown time.Duration) (*endpointPool, error) {
+	p := &endpointPool{cooldown: cooldown}
+
+	for _, addr := range addrs {
+		u, err := url.Parse(addr)
+		if err != nil {
+			return nil, err
+		}
+		p.endpoints = append(p.endpoints, &endpoint{url: u})
+	}
+
+	return p, nil
+}
+
+// pick returns the next available endpoint, or the one leaving quarantine
+// first when all of them are quarantined
+func (p *endpointPool) pick() *endpoint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	var soonest *endpoint
+	for i := 0; i < len(p.endpoints); i++ {
+		e := p.endpoints[(p.next+i)%len(p.endpoints)]
+		if !now.Before(e.quarantinedUntil) {
+			p.next = (p.next + i + 1) % len(p.endpoints)
+			return e
+		}
+		if soonest == nil || e.quarantinedUntil.Before(soonest.quarantinedUntil) {
+			soonest = e
+		}
+	}
+
+	return soonest
+}
+
+// report records the outcome of a request sent to e
+func (p *endpointPool) report(e *endpoint, failed bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if failed {
+		e.quarantinedUntil = time.Now().Add(p.cooldown)
+	} else {
+		e.quarantinedUntil = time.Time{}
+	}
+}
@@ -0,0 +1,100 @@
+package opentsdb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrNotFound is wrapped by the returned error when the server answers 404,
+// e.g. for a missing object or a disabled endpoint
+var ErrNotFound = errors.New("opentsdb: not found")
+
+// ErrUnauthorized is wrapped by the returned error when the server, or a
+// proxy in front of it, answers 401
+var ErrUnauthorized = errors.New("opentsdb: unauthorized")
+
+// ErrServerError is wrapped by the returned error when the server answers
+// with a 5xx status
+var ErrServerError = errors.New("opentsdb: server error")
+
+// ErrClientClosed is returned by the calls made on a closed Client, and by
+// the requests Close interrupted
+var ErrClientClosed = errors.New("opentsdb: client closed")
+
+// ErrResponseTooLarge is wrapped by the returned error when a response body
+// exceeds Options.MaxResponseBytes
+var ErrResponseTooLarge = errors.New("opentsdb: response too large")
+
+// APIError is the error object OpenTSDB sends in the body of failed requests
+type APIError struct {
+	// HTTP status code of the response
+	Code int `json:"code"`
+
+	Message string `json:"message"`
+	Details string `json:"details,omitempty"`
+
+	// Java stack trace, only sent when the server runs with debug enabled
+	Trace string `json:"trace,omitempty"`
+}
+
+func (e *APIError) Error() string {
+	if e.Details != "" {
+		return fmt.Sprintf("%d: %s: %s", e.Code, e.Message, e.Details)
+	}
+	return fmt.Sprintf("%d: %s", e.Code, e.Message)
+}
+
+// Is makes errors.Is(err, ErrNotFound) hold for 404 errors,
+// errors.Is(err, ErrUnauthorized) for 401 errors and
+// errors.Is(err, ErrServerError) for 5xx errors
+func (e *APIError) Is(target error) bool {
+	sentinel := statusSentinel(e.Code)
+	return sentinel != nil && sentinel == target
+}
+
+// statusSentinel returns the sentinel error matching a status code, nil if
+// there is none
+func statusSentinel(code int) error {
+	switch {
+	case code == http.StatusNotFound:
+		return ErrNotFound
+	case code == http.StatusUnauthorized:
+		return ErrUnauthorized
+	case code >= 500:
+		return ErrServerError
+	}
+	return nil
+}
+
+// statusError returns msg as an error wrapping the sentinel of the status
+// code, if any
+func statusError(code int, msg string) error {
+	if sentinel := statusSentinel(code); sentinel != nil {
+		return fmt.Errorf("%w: %s", sentinel, msg)
+	}
+	return errors.New(msg)
+}
+
+// responseError returns the error of a failed request, an *APIError when the
+// body holds one and otherwise the status line with the body text
+func responseError(resp *http.Response, body []byte) error {
+	var payload struct {
+		Error *APIError `json:"error"`
+	}
+	if json.Unmarshal(body, &payload) == nil && payload.Error != nil && payload.Error.Message != "" {
+		if payload.Error.Code == 0 {
+			payload.Error.Code = resp.StatusCode
+		}
+		return payload.Error
+	}
+
+	msg := resp.Status
+	if text := strings.TrimSpace(string(body)); text != "" {
+		msg += ": " + text
+	}
+
+	return statusError(resp.StatusCode, msg)
+}
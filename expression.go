@@ -0,0 +1,123 @@
+package opentsdb
+
+import (
+	"encoding/json"
+)
+
+// Types for the OpenTSDB 2.3 expression query language served at
+// api/query/exp
+
+type ExpTime struct {
+	// Required
+	Start interface{} `json:"start"`
+	End   interface{} `json:"end,omitempty"`
+
+	// Required
+	// Aggregator applied to every metric e.g.: "sum"
+	Aggregator string `json:"aggregator"`
+
+	Downsampler *ExpDownsampler `json:"downsampler,omitempty"`
+	Rate        bool            `json:"rate,omitempty"`
+}
+
+type ExpDownsampler struct {
+	Interval   string         `json:"interval"`
+	Aggregator string         `json:"aggregator"`
+	FillPolicy *ExpFillPolicy `json:"fillPolicy,omitempty"`
+}
+
+type ExpFillPolicy struct {
+	// One of nan, null, zero or scalar
+	Policy string `json:"policy"`
+
+	// Only used by the scalar policy
+	Value float64 `json:"value,omitempty"`
+}
+
+type ExpFilter struct {
+	Id   string   `json:"id"`
+	Tags []Filter `json:"tags,omitempty"`
+}
+
+type ExpMetric struct {
+	// Required
+	// Variable name the metric is referenced with in expressions e.g.: "a"
+	Id string `json:"id"`
+
+	// Required
+	Metric string `json:"metric"`
+
+	// Id of the filter set to apply
+	Filter string `json:"filter,omitempty"`
+
+	Aggregator string         `json:"aggregator,omitempty"`
+	FillPolicy *ExpFillPolicy `json:"fillPolicy,omitempty"`
+}
+
+type ExpJoin struct {
+	// One of intersection or union
+	Operator       string `json:"operator"`
+	UseQueryTags   bool   `json:"useQueryTags,omitempty"`
+	IncludeAggTags bool   `json:"includeAggTags,omitempty"`
+}
+
+type ExpExpression struct {
+	Id string `json:"id"`
+
+	// Expression over metric ids e.g.: "a / b"
+	Expr string `json:"expr"`
+
+	Join       *ExpJoin       `json:"join,omitempty"`
+	FillPolicy *ExpFillPolicy `json:"fillPolicy,omitempty"`
+}
+
+type ExpOutputSpec struct {
+	Id    string `json:"id"`
+	Alias string `json:"alias,omitempty"`
+}
+
+type ExpQuery struct {
+	Time        ExpTime         `json:"time"`
+	Filters     []ExpFilter     `json:"filters,omitempty"`
+	Metrics     []ExpMetric     `json:"metrics"`
+	Expressions []ExpExpression `json:"expressions,omitempty"`
+	Outputs     []ExpOutputSpec `json:"outputs,omitempty"`
+}
+
+type ExpSeriesMeta struct {
+	Index          int               `json:"index"`
+	Metrics        []string          `json:"metrics"`
+	CommonTags     map[string]string `json:"commonTags,omitempty"`
+	AggregatedTags []string          `json:"aggregatedTags,omitempty"`
+}
+
+type ExpDpsMeta struct {
+	FirstTimestamp int64 `json:"firstTimestamp"`
+	LastTimestamp  int64 `json:"lastTimestamp"`
+	SetCount       int   `json:"setCount"`
+	Series         int   `json:"series"`
+}
+
+type ExpOutput struct {
+	Id    string `json:"id"`
+	Alias string `json:"alias,omitempty"`
+
+	// Rows of [timestamp, series 0, series 1, ...], Meta describes each column
+	Dps     [][]json.Number `json:"dps"`
+	DpsMeta ExpDpsMeta      `json:"dpsMeta"`
+	Meta    []ExpSeriesMeta `json:"meta"`
+}
+
+type ExpResult struct {
+	Outputs []ExpOutput `json:"outputs"`
+}
+
+// Output returns the result series with the given expression or metric id
+func (r *ExpResult) Output(id string) (*ExpOutput, bool) {
+	for i := range r.Outputs {
+		if r.Outputs[i].Id == id {
+			return &r.Outputs[i], true
+		}
+	}
+	return nil, false
+}
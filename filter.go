@@ -0,0 +1,57 @@
+package opentsdb
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type Filter struct {
+	// Filter type e.g.: "literal_or", "wildcard", "regexp"
+	Type    string `json:"type"`
+	Tagk    string `json:"tagk"`
+	Filter  string `json:"filter"`
+	GroupBy bool   `json:"groupBy"`
+}
+
+// LiteralOr matches series whose tagk value is exactly one of values
+func LiteralOr(tagk string, values []string, groupBy bool) Filter {
+	return Filter{Type: "literal_or", Tagk: tagk, Filter: strings.Join(values, "|"), GroupBy: groupBy}
+}
+
+// ILiteralOr is LiteralOr ignoring case
+func ILiteralOr(tagk string, values []string, groupBy bool) Filter {
+	return Filter{Type: "iliteral_or", Tagk: tagk, Filter: strings.Join(values, "|"), GroupBy: groupBy}
+}
+
+// NotLiteralOr matches series whose tagk value is none of values
+func NotLiteralOr(tagk string, values []string, groupBy bool) Filter {
+	return Filter{Type: "not_literal_or", Tagk: tagk, Filter: strings.Join(values, "|"), GroupBy: groupBy}
+}
+
+// Wildcard matches tagk values against a pattern using "*" e.g.: "web*"
+func Wildcard(tagk string, pattern string, groupBy bool) Filter {
+	return Filter{Type: "wildcard", Tagk: tagk, Filter: pattern, GroupBy: groupBy}
+}
+
+// Regexp matches tagk values against a regular expression. The pattern is
+// compiled first so mistakes are caught before the query is sent, Go and Java
+// syntaxes differ slightly so a few valid Java patterns can be refused.
+func Regexp(tagk string, pattern string, groupBy bool) (Filter, error) {
+	if _, err := regexp.Compile(pattern); err != nil {
+		return Filter{}, fmt.Errorf("FilterError: invalid regexp %q: %s", pattern, err)
+	}
+	return Filter{Type: "regexp", Tagk: tagk, Filter: pattern, GroupBy: groupBy}, nil
+}
+
+// GeoBoundingBox matches series whose tagk holds a "lat,lon" value inside
+// the box between the two corners. It needs the geo_bbox filter plugin on the
+// server.
+func GeoBoundingBox(tagk string, lat1, lon1, lat2, lon2 float64, groupBy bool) Filter {
+	corners := make([]string, 0, 4)
+	for _, v := range []float64{lat1, lon1, lat2, lon2} {
+		corners = append(corners, strconv.FormatFloat(v, 'f', -1, 64))
+	}
+	return Filter{Type: "geo_bbox", Tagk: tagk, Filter: strings.Join(corners, ","), GroupBy: groupBy}
+}
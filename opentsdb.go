@@ -2,20 +2,41 @@ package opentsdb
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
+	"sync"
 	"time"
-	"errors"
 )
 
+// Version of this library, sent in the default User-Agent
+const libraryVersion = "0.1.0"
+
+const DefaultUserAgent = "go-opentsdb/" + libraryVersion
+
 type Options struct {
 	// Host value for the opentsdb server
 	// Default: 127.0.0.1
 	Endpoint string
 
+	// Several TSD endpoints to spread requests over round-robin, replacing
+	// Endpoint when set. An endpoint failing with a network error or a 5xx
+	// status is skipped for EndpointCooldown.
+	Endpoints []string
+
+	// Default: 30s
+	EndpointCooldown time.Duration
+
 	// Timeout for http client
 	// Default: no timeout
 	Timeout time.Duration
@@ -25,14 +46,137 @@ type Options struct {
 
 	// Password for basic https auth
 	Password string
+
+	// Token sent as "Authorization: Bearer <token>", takes precedence over
+	// basic auth when both are set
+	BearerToken string
+
+	// Extra headers sent with every request, e.g. {"X-Tenant-ID": "42"}.
+	// They never replace Content-Type or Authorization.
+	Headers map[string]string
+
+	// User-Agent header of every request
+	// Default: DefaultUserAgent
+	UserAgent string
+
+	// HTTP client used for every request, e.g. to share a tuned client
+	// between several opentsdb clients. The client is not owned, Close leaves
+	// its connections alone and Timeout is not applied to it.
+	// Default: a new client with its own transport
+	HTTPClient *http.Client
+
+	// TLS configuration for https endpoints, e.g. client certificates or a
+	// custom CA pool. Ignored when HTTPClient is set.
+	// Default: the system roots and no client certificate
+	TLSConfig *tls.Config
+
+	// Connection pool tuning of the transport, ignored when HTTPClient is set
+	// Default: 100 idle connections, http.DefaultMaxIdleConnsPerHost per
+	// host, closed after 90s idle, as with http.DefaultTransport
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+
+	// Open a new connection for every request, e.g. when a firewall drops
+	// idle connections and reusing them fails with resets. Every request
+	// then pays for the connection setup, and TLS handshake, so throughput
+	// drops. Ignored when HTTPClient is set.
+	DisableKeepAlives bool
+
+	// Proxy returning the proxy URL of each request, e.g.
+	// http.ProxyURL(u) for a fixed one. Ignored when HTTPClient is set.
+	// Default: http.ProxyFromEnvironment
+	Proxy func(*http.Request) (*url.URL, error)
+
+	// Build requests without sending them, calls then fail with a
+	// *PreparedRequest holding what would have been sent, e.g. to check
+	// the queries built by an application
+	DryRun bool
+
+	// Maximum size of a response body, after decompression. Larger
+	// responses fail with ErrResponseTooLarge, 0 gives the default and a
+	// negative value removes the limit. QueryStream isn't limited.
+	// Default: 64MiB
+	MaxResponseBytes int64
+
+	// Called on every attempt of a request right before it is sent, with
+	// its final URL, e.g. to sign it. Read the body with req.GetBody, the
+	// request is aborted when it returns an error.
+	RequestInterceptor func(req *http.Request) error
+
+	// Gzip the body of Put requests, the server must accept compressed
+	// requests
+	CompressPut bool
+
+	// Retries of requests failing with a network error or a 5xx status
+	// Default: no retries
+	RetryPolicy RetryPolicy
+
+	// Maximum number of Put requests sent per second, a Put waits for its
+	// turn or until its context is done. Every retry of a Put takes a turn
+	// too.
+	// Default: no limit
+	RateLimit float64
+
+	// Number of Put requests that can be sent at once before RateLimit
+	// applies
+	// Default: 1
+	RateBurst int
+
+	// Cache of Query responses. Only queries with an absolute end time in
+	// the past are cached, the data they return doesn't change anymore.
+	// Default: no caching
+	Cache Cache
+
+	// Time responses are kept in Cache
+	// Default: 1h
+	CacheTTL time.Duration
+
+	// Called before every API call with its method, API path and request
+	// ID, e.g. "POST", "api/query", "5f0c..."
+	OnRequest func(method, path, requestID string)
+
+	// Called once every API call is done, retries included. err is set when
+	// no response was received, status is 0 then.
+	OnResponse func(method, path, requestID string, status int, dur time.Duration, err error)
 }
 
 type Client struct {
-	url        *url.URL
+	endpoints  *endpointPool
 	httpClient *http.Client
 	tr         *http.Transport
-	username   string
-	password   string
+	userAgent  string
+
+	compressPut bool
+	retry       RetryPolicy
+	limiter     *rateLimiter
+	cache       Cache
+	cacheTTL    time.Duration
+	dryRun      bool
+	maxBody     int64
+	intercept   func(req *http.Request) error
+	onRequest   func(method, path, requestID string)
+	onResponse  func(method, path, requestID string, status int, dur time.Duration, err error)
+
+	// Canceled by Close, every request is bound to it
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// Deadline of every call, set on the clients returned by WithTimeout
+	timeout time.Duration
+
+	// Shared with the clients returned by WithTimeout
+	creds *credentials
+}
+
+type credentials struct {
+	// Guards the credentials and headers, they can be changed while
+	// requests run
+	mu          sync.RWMutex
+	username    string
+	password    string
+	bearerToken string
+	headers     map[string]string
 }
 
 func NewClient(opt Options) (*Client, error) {
@@ -40,200 +184,1076 @@ func NewClient(opt Options) (*Client, error) {
 		opt.Endpoint = "http://127.0.0.1:4242"
 	}
 
-	endpoint := fmt.Sprintf("%s", opt.Endpoint)
+	addrs := opt.Endpoints
+	if len(addrs) == 0 {
+		addrs = []string{opt.Endpoint}
+	}
 
-	u, err := url.Parse(endpoint)
+	if opt.EndpointCooldown == 0 {
+		opt.EndpointCooldown = 30 * time.Second
+	}
 
+	endpoints, err := newEndpointPool(addrs, opt.EndpointCooldown)
 	if err != nil {
 		return nil, err
 	}
 
-	tr := &http.Transport{}
+	c := &Client{
+		endpoints:   endpoints,
+		httpClient:  opt.HTTPClient,
+		userAgent:   opt.UserAgent,
+		compressPut: opt.CompressPut,
+		retry:       opt.RetryPolicy,
+		onRequest:   opt.OnRequest,
+		onResponse:  opt.OnResponse,
+		cache:       opt.Cache,
+		cacheTTL:    opt.CacheTTL,
+		dryRun:      opt.DryRun,
+		maxBody:     opt.MaxResponseBytes,
+		intercept:   opt.RequestInterceptor,
+		creds: &credentials{
+			username:    opt.Username,
+			password:    opt.Password,
+			bearerToken: opt.BearerToken,
+			headers:     make(map[string]string, len(opt.Headers)),
+		},
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+
+	if c.maxBody == 0 {
+		c.maxBody = 64 << 20
+	}
+
+	if c.cacheTTL == 0 {
+		c.cacheTTL = time.Hour
+	}
 
-	return &Client{
-		url: u,
-		httpClient: &http.Client{
+	if opt.RateLimit > 0 {
+		if opt.RateBurst <= 0 {
+			opt.RateBurst = 1
+		}
+		c.limiter = newRateLimiter(opt.RateLimit, opt.RateBurst)
+	}
+
+	for k, v := range opt.Headers {
+		c.creds.headers[k] = v
+	}
+
+	if c.userAgent == "" {
+		c.userAgent = DefaultUserAgent
+	}
+
+	if opt.MaxIdleConns == 0 {
+		opt.MaxIdleConns = 100
+	}
+
+	if opt.IdleConnTimeout == 0 {
+		opt.IdleConnTimeout = 90 * time.Second
+	}
+
+	if opt.Proxy == nil {
+		opt.Proxy = http.ProxyFromEnvironment
+	}
+
+	if c.httpClient == nil {
+		c.tr = &http.Transport{
+			Proxy:               opt.Proxy,
+			TLSClientConfig:     opt.TLSConfig,
+			MaxIdleConns:        opt.MaxIdleConns,
+			MaxIdleConnsPerHost: opt.MaxIdleConnsPerHost,
+			IdleConnTimeout:     opt.IdleConnTimeout,
+			DisableKeepAlives:   opt.DisableKeepAlives,
+		}
+		c.httpClient = &http.Client{
 			Timeout:   opt.Timeout,
-			Transport: tr,
-		},
-		tr:       tr,
-		username: opt.Username,
-		password: opt.Password,
-	}, nil
+			Transport: c.tr,
+		}
+	}
+
+	return c, nil
 }
 
+func (c *Client) SetUsername(username string) error {
+	c.creds.mu.Lock()
+	c.creds.username = username
+	c.creds.mu.Unlock()
+	return nil
+}
 
 func (c *Client) SetPassword(password string) error {
-	c.password = password
+	c.creds.mu.Lock()
+	c.creds.password = password
+	c.creds.mu.Unlock()
 	return nil
 }
 
+func (c *Client) SetBearerToken(token string) error {
+	c.creds.mu.Lock()
+	c.creds.bearerToken = token
+	c.creds.mu.Unlock()
+	return nil
+}
+
+// AddHeader sets a header sent with every following request
+func (c *Client) AddHeader(key, value string) {
+	c.creds.mu.Lock()
+	c.creds.headers[key] = value
+	c.creds.mu.Unlock()
+}
+
+// WithTimeout returns a client sharing c's connections, credentials and
+// settings whose calls each time out after d, e.g. for long range queries.
+// c is left unchanged. Closing either client closes both.
+func (c *Client) WithTimeout(d time.Duration) *Client {
+	cc := *c
+	cc.timeout = d
+	return &cc
+}
 
+// Close cancels the requests in flight and releases idle connections. Calls
+// made after Close return ErrClientClosed.
 func (c *Client) Close() error {
-	c.tr.CloseIdleConnections()
+	c.cancel()
+
+	// A client supplied through Options.HTTPClient isn't ours to close
+	if c.tr != nil {
+		c.tr.CloseIdleConnections()
+	}
 	return nil
 }
 
-func (c *Client) Aggregators() error {
-	return nil
+func (c *Client) Aggregators() ([]string, error) {
+	return c.AggregatorsContext(context.Background())
 }
 
-func (c *Client) Annotation() error {
-	return nil
+func (c *Client) AggregatorsContext(ctx context.Context) ([]string, error) {
+
+	body, err := c.ExecRequestContext(ctx, "GET", "api/aggregators", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]string, 0)
+
+	if len(body) == 0 {
+		return values, nil
+	}
+
+	if err := json.Unmarshal(body, &values); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+
 }
 
-func (c *Client) Config() error {
-	return nil
+func (c *Client) Config() (map[string]string, error) {
+	return c.ConfigContext(context.Background())
 }
 
-func (c *Client) Dropcaches() error {
-	return nil
+func (c *Client) ConfigContext(ctx context.Context) (map[string]string, error) {
+
+	body, err := c.ExecRequestContext(ctx, "GET", "api/config", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	config := make(map[string]string)
+	if err := json.Unmarshal(body, &config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+
 }
 
-func (c *Client) Put(bp *BatchPoints, params string) ([]byte, error) {
-	data, err := bp.ToJson()
+func (c *Client) Filters() (map[string]FilterInfo, error) {
+	return c.FiltersContext(context.Background())
+}
+
+func (c *Client) FiltersContext(ctx context.Context) (map[string]FilterInfo, error) {
+
+	body, err := c.ExecRequestContext(ctx, "GET", "api/config/filters", nil)
 	if err != nil {
 		return nil, err
 	}
 
-	u := c.url
-	u.Path = "api/put"
-	u.RawQuery = params
+	filters := make(map[string]FilterInfo)
+	if err := json.Unmarshal(body, &filters); err != nil {
+		return nil, err
+	}
+
+	return filters, nil
+
+}
+
+type DropcachesResult struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
 
-	req, err := http.NewRequest("POST", u.String(), bytes.NewReader(data))
+func (c *Client) Dropcaches() (*DropcachesResult, error) {
+	return c.DropcachesContext(context.Background())
+}
+
+func (c *Client) DropcachesContext(ctx context.Context) (*DropcachesResult, error) {
+
+	body, err := c.ExecRequestContext(ctx, "POST", "api/dropcaches", nil)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	if c.username != "" {
-		req.SetBasicAuth(c.username, c.password)
+
+	result := &DropcachesResult{}
+	if err := json.Unmarshal(body, result); err != nil {
+		return nil, err
 	}
 
-	resp, err := c.httpClient.Do(req)
+	return result, nil
+
+}
+
+func (c *Client) Put(bp *BatchPoints, params string) ([]byte, error) {
+	return c.PutContext(context.Background(), bp, params)
+}
+
+func (c *Client) PutContext(ctx context.Context, bp *BatchPoints, params string) ([]byte, error) {
+	data, err := bp.ToJson()
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	body, err := ioutil.ReadAll(resp.Body)
+	if c.compressPut {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		data = buf.Bytes()
+	}
+
+	if c.limiter != nil {
+		ctx = context.WithValue(ctx, rateLimitedKey{}, true)
+	}
+
+	req, err := c.newRequest(ctx, "POST", "api/put", params, data)
+	if err != nil {
+		return nil, err
+	}
+	if c.compressPut {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, body, err := c.send(req)
 	if err != nil {
 		return nil, err
 	}
 
 	// If StatusCode 4XX or 5XX -> error
 	if resp.StatusCode >= 400 {
-		return body, fmt.Errorf(resp.Status)
+		return body, responseError(resp, body)
 	}
-	
+
 	return body, nil
 }
 
+type PutError struct {
+	DataPoint Point  `json:"datapoint"`
+	Error     string `json:"error"`
+}
+
+type PutResponse struct {
+	Success int        `json:"success"`
+	Failed  int        `json:"failed"`
+	Errors  []PutError `json:"errors"`
+}
+
+// PutWithDetails sends bp and reports which points were stored. OpenTSDB
+// answers 400 when some points are rejected, in that case the response is
+// still returned with Failed and Errors filled in and a nil error.
+func (c *Client) PutWithDetails(bp *BatchPoints) (*PutResponse, error) {
+	return c.PutWithDetailsContext(context.Background(), bp)
+}
+
+func (c *Client) PutWithDetailsContext(ctx context.Context, bp *BatchPoints) (*PutResponse, error) {
+
+	body, err := c.PutContext(ctx, bp, "details")
+	if err != nil && len(body) == 0 {
+		return nil, err
+	}
+
+	result := &PutResponse{}
+	if jsonErr := json.Unmarshal(body, result); jsonErr != nil || (err != nil && result.Failed == 0) {
+		// Not a details report, e.g. a malformed request
+		if err != nil {
+			return nil, err
+		}
+		return nil, jsonErr
+	}
+
+	return result, nil
+
+}
+
+type PutResult struct {
+	// Index of the first point of the chunk in the original batch
+	Offset int
+
+	// Number of points in the chunk
+	Size int
+
+	// Response of the server for the chunk
+	Body []byte
+
+	// Error of the chunk, nil when it was stored
+	Err error
+}
+
+// PutChunked sends the points of bp in batches of at most chunkSize points.
+// Every chunk is sent even if a previous one failed, the outcome of each is
+// reported in the returned results. The error is non-nil when any chunk
+// failed.
+func (c *Client) PutChunked(bp *BatchPoints, chunkSize int, params string) ([]PutResult, error) {
+	return c.PutChunkedContext(context.Background(), bp, chunkSize, params)
+}
+
+func (c *Client) PutChunkedContext(ctx context.Context, bp *BatchPoints, chunkSize int, params string) ([]PutResult, error) {
+	if chunkSize <= 0 {
+		return nil, errors.New("PutError: chunkSize must be greater than 0")
+	}
+
+	chunks := bp.Split(chunkSize)
+	results := make([]PutResult, 0, len(chunks))
+	failed := 0
+
+	offset := 0
+	for _, chunk := range chunks {
+		body, err := c.PutContext(ctx, chunk, params)
+		if err != nil {
+			failed++
+		}
+
+		results = append(results, PutResult{
+			Offset: offset,
+			Size:   len(chunk.Points),
+			Body:   body,
+			Err:    err,
+		})
+		offset += len(chunk.Points)
+	}
+
+	if failed > 0 {
+		return results, fmt.Errorf("PutError: %d of %d chunks failed", failed, len(results))
+	}
+
+	return results, nil
+}
+
 func (c *Client) Query(q *QueryParams) ([]byte, error) {
+	return c.QueryContext(context.Background(), q)
+}
+
+func (c *Client) QueryContext(ctx context.Context, q *QueryParams) ([]byte, error) {
+
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
 
 	data, err := json.Marshal(q)
 	if err != nil {
 		return nil, err
 	}
 
-	body, err := c.ExecRequest("POST", "api/query", data)
+	var key string
+	cacheable := false
+	if c.cache != nil && !c.dryRun {
+		key, cacheable = queryCacheKey(c.cacheScope(), q, data)
+	}
+	if cacheable {
+		if body, ok := c.cache.Get(key); ok {
+			return body, nil
+		}
+	}
+
+	r, err := c.execRaw(ctx, "POST", "api/query", q.rawQuery(), data)
 	if err != nil {
 		return nil, err
 	}
 
-	return body, nil
+	if cacheable {
+		c.cache.Set(key, r.Body, c.cacheTTL)
+	}
+
+	return r.Body, nil
 
 }
 
-func (c *Client) QueryDelete(q *QueryParams) ([]byte, error) {
+// QueryRaw is Query returning the status and headers of the response along
+// with its body, e.g. for timing headers added by a proxy. It skips
+// Options.Cache.
+func (c *Client) QueryRaw(q *QueryParams) (*Response, error) {
+	return c.QueryRawContext(context.Background(), q)
+}
+
+func (c *Client) QueryRawContext(ctx context.Context, q *QueryParams) (*Response, error) {
+
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
 
 	data, err := json.Marshal(q)
 	if err != nil {
 		return nil, err
 	}
 
-	body, err := c.ExecRequest("DELETE", "api/query", data)
+	return c.execRaw(ctx, "POST", "api/query", q.rawQuery(), data)
+
+}
+
+func (c *Client) QueryTyped(q *QueryParams) ([]QueryResult, error) {
+	return c.QueryTypedContext(context.Background(), q)
+}
+
+func (c *Client) QueryTypedContext(ctx context.Context, q *QueryParams) ([]QueryResult, error) {
+
+	body, err := c.QueryContext(ctx, q)
 	if err != nil {
 		return nil, err
 	}
 
-	return body, nil
+	// No series matched, some proxies also turn the empty array into an
+	// empty body
+	results := make([]QueryResult, 0)
+	if len(bytes.TrimSpace(body)) == 0 {
+		return results, nil
+	}
+	if err := decodeNumbers(body, &results); err != nil {
+		return nil, err
+	}
+
+	return results, nil
 
 }
 
-func (c *Client) Search() error {
-	return nil
+// QuerySimple queries metric aggregated with aggregator between start and
+// end, an empty end meaning now, e.g.
+// QuerySimple("sys.cpu.user", "avg", "1h-ago", "", map[string]string{"host": "*"})
+func (c *Client) QuerySimple(metric, aggregator, start, end string, tags map[string]string) ([]QueryResult, error) {
+	return c.QuerySimpleContext(context.Background(), metric, aggregator, start, end, tags)
 }
 
-func (c *Client) Serializers() error {
-	return nil
+func (c *Client) QuerySimpleContext(ctx context.Context, metric, aggregator, start, end string, tags map[string]string) ([]QueryResult, error) {
+	b := NewQuery().Start(start).AddMetric(aggregator, metric).WithTags(tags)
+	if end != "" {
+		b.End(end)
+	}
+
+	q, err := b.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	return c.QueryTypedContext(ctx, q)
 }
 
-func (c *Client) Stats() error {
-	return nil
+// QueryMap is QueryTyped returning the data points of each series, ordered,
+// keyed by SeriesKey. A series returned twice, e.g. by two sub-queries on the
+// same metric and tags, is an error as their points can't be told apart.
+func (c *Client) QueryMap(q *QueryParams) (map[string][]DataPoint, error) {
+	return c.QueryMapContext(context.Background(), q)
+}
+
+func (c *Client) QueryMapContext(ctx context.Context, q *QueryParams) (map[string][]DataPoint, error) {
+
+	results, err := c.QueryTypedContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	series := make(map[string][]DataPoint, len(results))
+	for _, r := range results {
+		if r.StatsSummary != nil {
+			continue
+		}
+
+		key := SeriesKey(r.Metric, r.Tags)
+		if _, ok := series[key]; ok {
+			return nil, fmt.Errorf("QueryError: series %s returned more than once", key)
+		}
+
+		points, err := r.DataPoints()
+		if err != nil {
+			return nil, err
+		}
+		series[key] = points
+	}
+
+	return series, nil
+
+}
+
+// QueryDelete deletes the data points matched by q and returns them. It
+// refuses to send anything unless opts.Confirm is set. The server must run
+// with tsd.http.query.allow_delete enabled.
+func (c *Client) QueryDelete(q *QueryParams, opts DeleteOptions) (*DeleteResult, error) {
+	return c.QueryDeleteContext(context.Background(), q, opts)
+}
+
+func (c *Client) QueryDeleteContext(ctx context.Context, q *QueryParams, opts DeleteOptions) (*DeleteResult, error) {
+
+	if !opts.Confirm {
+		return nil, errors.New("QueryError: delete not confirmed, set DeleteOptions.Confirm to delete the matched data points")
+	}
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(q)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := c.execRequest(ctx, "DELETE", "api/query", q.rawQuery(), data)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DeleteResult{Series: make([]QueryResult, 0)}
+	if err := decodeNumbers(body, &result.Series); err != nil {
+		return nil, err
+	}
+	for i := range result.Series {
+		result.DeletedPoints += result.Series[i].pointCount()
+	}
+
+	return result, nil
+
+}
+
+// DeleteSeries deletes the data points of metric with the given tags between
+// start and end, an empty end meaning now. It returns the number of deleted
+// points. Calling it is the confirmation, see QueryDelete for the server
+// requirements.
+func (c *Client) DeleteSeries(metric string, tags map[string]string, start, end string) (int, error) {
+	return c.DeleteSeriesContext(context.Background(), metric, tags, start, end)
+}
+
+func (c *Client) DeleteSeriesContext(ctx context.Context, metric string, tags map[string]string, start, end string) (int, error) {
+	if metric == "" {
+		return 0, errors.New("QueryError: metric can not be empty")
+	}
+	if start == "" {
+		return 0, errors.New("QueryError: start can not be empty")
+	}
+
+	q := &QueryParams{
+		Start: start,
+		// "none" keeps every series apart so each point is counted once
+		Queries: []Query{{Aggregator: "none", Metric: metric, Tags: tags}},
+	}
+	if end != "" {
+		q.End = end
+	}
+
+	result, err := c.QueryDeleteContext(ctx, q, DeleteOptions{Confirm: true})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedPoints, nil
+}
+
+func (c *Client) QueryExp(q *ExpQuery) (*ExpResult, error) {
+	return c.QueryExpContext(context.Background(), q)
+}
+
+func (c *Client) QueryExpContext(ctx context.Context, q *ExpQuery) (*ExpResult, error) {
+
+	data, err := json.Marshal(q)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := c.ExecRequestContext(ctx, "POST", "api/query/exp", data)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ExpResult{}
+	if err := decodeNumbers(body, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+
+}
+
+// QueryGExp runs a Graphite style expression such as
+// "scale(sum:proc.stat.cpu,100)" against api/query/gexp. The aggregator is
+// only used when expr is a bare metric name, which is then queried as
+// "aggregator:metric". An empty end means now.
+func (c *Client) QueryGExp(expr string, start, end string, aggregator string) ([]byte, error) {
+	return c.QueryGExpContext(context.Background(), expr, start, end, aggregator)
+}
+
+func (c *Client) QueryGExpContext(ctx context.Context, expr string, start, end string, aggregator string) ([]byte, error) {
+	if expr == "" {
+		return nil, errors.New("QueryError: expression can not be empty")
+	}
+	if start == "" {
+		return nil, errors.New("QueryError: start can not be empty")
+	}
+
+	if aggregator != "" && !strings.ContainsAny(expr, ":(") {
+		expr = aggregator + ":" + expr
+	}
+
+	params := url.Values{}
+	params.Set("start", start)
+	if end != "" {
+		params.Set("end", end)
+	}
+	params.Set("exp", expr)
+
+	return c.execRequest(ctx, "GET", "api/query/gexp", params.Encode(), nil)
+}
+
+func (c *Client) QueryLast(q *LastQueryParams) ([]LastDataPoint, error) {
+	return c.QueryLastContext(context.Background(), q)
+}
+
+func (c *Client) QueryLastContext(ctx context.Context, q *LastQueryParams) ([]LastDataPoint, error) {
+
+	data, err := json.Marshal(q)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := c.ExecRequestContext(ctx, "POST", "api/query/last", data)
+	if err != nil {
+		return nil, err
+	}
+
+	points := make([]LastDataPoint, 0)
+	if err := decodeNumbers(body, &points); err != nil {
+		return nil, err
+	}
+
+	return points, nil
+
+}
+
+type SerializerInfo struct {
+	Serializer          string   `json:"serializer"`
+	Formatters          []string `json:"formatters"`
+	Parsers             []string `json:"parsers"`
+	Class               string   `json:"class"`
+	RequestContentType  string   `json:"request_content_type,omitempty"`
+	ResponseContentType string   `json:"response_content_type"`
+}
+
+func (c *Client) Serializers() ([]SerializerInfo, error) {
+	return c.SerializersContext(context.Background())
+}
+
+func (c *Client) SerializersContext(ctx context.Context) ([]SerializerInfo, error) {
+
+	body, err := c.ExecRequestContext(ctx, "GET", "api/serializers", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	serializers := make([]SerializerInfo, 0)
+	if err := json.Unmarshal(body, &serializers); err != nil {
+		return nil, err
+	}
+
+	return serializers, nil
+
 }
 
 func (c *Client) Suggest(s *SuggestParams) ([]string, error) {
+	return c.SuggestContext(context.Background(), s)
+}
+
+func (c *Client) SuggestContext(ctx context.Context, s *SuggestParams) ([]string, error) {
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
 
 	data, err := json.Marshal(s)
 	if err != nil {
 		return nil, err
 	}
 
-	body, err := c.ExecRequest("POST", "api/suggest", data)
+	body, err := c.ExecRequestContext(ctx, "POST", "api/suggest", data)
 	if err != nil {
 		return nil, err
 	}
 
 	values := make([]string, 0)
-
-	json.Unmarshal(body, &values)
+	if err := json.Unmarshal(body, &values); err != nil {
+		return nil, err
+	}
 
 	return values, nil
 
 }
 
+// SuggestDetailed is Suggest also reporting whether the values were cut at
+// s.Max, or at the server's default of 25 when it's 0
+func (c *Client) SuggestDetailed(s *SuggestParams) (*SuggestResult, error) {
+	return c.SuggestDetailedContext(context.Background(), s)
+}
+
+func (c *Client) SuggestDetailedContext(ctx context.Context, s *SuggestParams) (*SuggestResult, error) {
+
+	values, err := c.SuggestContext(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	max := s.Max
+	if max <= 0 {
+		max = defaultSuggestMax
+	}
+
+	return &SuggestResult{Values: values, Truncated: len(values) >= max}, nil
+
+}
+
+// MetricExists reports whether metric has a UID. Only an exact name counts,
+// metrics it is merely a prefix of don't.
+func (c *Client) MetricExists(metric string) (bool, error) {
+	return c.MetricExistsContext(context.Background(), metric)
+}
+
+func (c *Client) MetricExistsContext(ctx context.Context, metric string) (bool, error) {
+	if metric == "" {
+		return false, errors.New("SuggestError: metric can not be empty")
+	}
+
+	// Suggestions are sorted, the metric itself comes before the longer
+	// names it prefixes
+	values, err := c.SuggestContext(ctx, &SuggestParams{Type: SuggestTypeMetrics, Match: metric, Max: 1})
+	if err != nil {
+		return false, err
+	}
+
+	return len(values) > 0 && values[0] == metric, nil
+}
+
 func (c *Client) ExecRequest(requestType string, requestPath string, requestParams []byte) ([]byte, error) {
+	return c.ExecRequestContext(context.Background(), requestType, requestPath, requestParams)
+}
+
+// ExecRequestContext is ExecRequest bound to ctx, cancelling ctx aborts the
+// request
+func (c *Client) ExecRequestContext(ctx context.Context, requestType string, requestPath string, requestParams []byte) ([]byte, error) {
+	return c.execRequest(ctx, requestType, requestPath, "", requestParams)
+}
+
+// execRequest is ExecRequestContext with an encoded query string for the
+// endpoints that take their arguments in the URL
+func (c *Client) execRequest(ctx context.Context, requestType string, requestPath string, rawQuery string, requestParams []byte) ([]byte, error) {
+
+	r, err := c.execRaw(ctx, requestType, requestPath, rawQuery, requestParams)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Body, nil
 
-	u := c.url
-	u.Path = requestPath
+}
 
-	req, err := http.NewRequest(requestType, u.String(), bytes.NewReader(requestParams))
+// Response is a whole API response, for callers needing more than the body
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// execRaw is execRequest returning the whole response. The response is also
+// returned along with the error of 4XX and 5XX statuses.
+func (c *Client) execRaw(ctx context.Context, requestType string, requestPath string, rawQuery string, requestParams []byte) (*Response, error) {
+
+	resp, body, err := c.doRequest(ctx, requestType, requestPath, rawQuery, requestParams)
 	if err != nil {
 		return nil, err
 	}
+
+	r := &Response{StatusCode: resp.StatusCode, Header: resp.Header, Body: body}
+	if resp.StatusCode >= 400 {
+		return r, responseError(resp, body)
+	}
+
+	return r, nil
+
+}
+
+// doRequest sends the request and reads the whole response body, leaving the
+// status code checks to the caller
+func (c *Client) doRequest(ctx context.Context, requestType string, requestPath string, rawQuery string, requestParams []byte) (*http.Response, []byte, error) {
+
+	req, err := c.newRequest(ctx, requestType, requestPath, rawQuery, requestParams)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return c.send(req)
+
+}
+
+// RequestIDHeader carries an ID generated for every call, the same for all
+// its retries, so proxy and TSD logs can be correlated and retried writes
+// spotted. A value set with Options.Headers or AddHeader replaces it.
+const RequestIDHeader = "X-Request-ID"
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// newRequest builds an API request with the client's headers and credentials.
+// Its URL only holds the API path and query, send completes it with the
+// endpoint picked for each attempt.
+func (c *Client) newRequest(ctx context.Context, requestType string, requestPath string, rawQuery string, requestParams []byte) (*http.Request, error) {
+
+	req, err := http.NewRequestWithContext(ctx, requestType, "", bytes.NewReader(requestParams))
+	if err != nil {
+		return nil, err
+	}
+	req.URL.Path = requestPath
+	req.URL.RawQuery = rawQuery
+	req.Header.Set("User-Agent", c.userAgent)
+
+	// Asking explicitly turns off the transport's transparent decompression,
+	// send takes care of it
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	c.creds.mu.RLock()
+	for k, v := range c.creds.headers {
+		req.Header.Set(k, v)
+	}
 	req.Header.Set("Content-Type", "application/json")
+	if req.Header.Get(RequestIDHeader) == "" {
+		req.Header.Set(RequestIDHeader, newRequestID())
+	}
+	if c.creds.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.creds.bearerToken)
+	} else if c.creds.username != "" {
+		req.SetBasicAuth(c.creds.username, c.creds.password)
+	}
+	c.creds.mu.RUnlock()
+
+	return req, nil
 
-	if c.username != "" {
-		req.SetBasicAuth(c.username, c.password)
+}
+
+// send executes req and reads the whole response body, retrying as set by
+// the client's RetryPolicy. Every attempt goes to the next endpoint.
+func (c *Client) send(req *http.Request) (*http.Response, []byte, error) {
+
+	if c.dryRun {
+		return nil, nil, c.prepare(req)
+	}
+
+	ctx, release, err := c.bind(req.Context())
+	if err != nil {
+		return nil, nil, err
 	}
+	defer release()
+	req = req.WithContext(ctx)
+
+	done := c.observe(req)
+	resp, body, err := c.sendAttempts(req)
+	if err != nil && c.ctx.Err() != nil {
+		err = ErrClientClosed
+	}
+	done(resp, err)
+
+	return resp, body, err
+
+}
+
+// observe calls the OnRequest hook for req and returns the function
+// reporting its outcome to the OnResponse hook
+func (c *Client) observe(req *http.Request) func(resp *http.Response, err error) {
+	method, path, id := req.Method, req.URL.Path, req.Header.Get(RequestIDHeader)
+	if c.onRequest != nil {
+		c.onRequest(method, path, id)
+	}
+
+	start := time.Now()
+	return func(resp *http.Response, err error) {
+		if c.onResponse == nil {
+			return
+		}
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		c.onResponse(method, path, id, status, time.Since(start), err)
+	}
+}
+
+func (c *Client) sendAttempts(req *http.Request) (*http.Response, []byte, error) {
+
+	api := *req.URL
+
+	for attempt := 0; ; attempt++ {
+		if c.limiter != nil && req.Context().Value(rateLimitedKey{}) != nil {
+			if err := c.limiter.wait(req.Context()); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		e := c.endpoints.pick()
+		req.URL = e.requestURL(api.Path, api.RawQuery)
+		req.Host = req.URL.Host
+
+		if c.intercept != nil {
+			if err := c.intercept(req); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		resp, body, err := c.sendOnce(req)
+		c.endpoints.report(e, retryable(resp, err) && req.Context().Err() == nil)
+
+		if attempt >= c.retry.MaxRetries || !retryable(resp, err) || req.Context().Err() != nil {
+			return resp, body, err
+		}
+
+		timer := time.NewTimer(c.retry.backoff(attempt))
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, nil, req.Context().Err()
+		case <-timer.C:
+		}
+
+		// The body was consumed by the previous attempt
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+}
+
+func (c *Client) sendOnce(req *http.Request) (*http.Response, []byte, error) {
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode > 300 {
-		return nil, errors.New(resp.Status)
+	reader, err := responseBody(resp)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer reader.Close()
+
+	if c.maxBody < 0 {
+		body, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		return resp, body, nil
 	}
 
-	body, err := ioutil.ReadAll(resp.Body)
+	body, err := ioutil.ReadAll(io.LimitReader(reader, c.maxBody+1))
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	if int64(len(body)) > c.maxBody {
+		return nil, nil, fmt.Errorf("%w: more than %d bytes", ErrResponseTooLarge, c.maxBody)
 	}
 
-	return body, nil
+	return resp, body, nil
 
 }
 
-func (c *Client) Tree() error {
-	return nil
+// bind derives from ctx a context also canceled by Close, release must be
+// called once the request is done. It fails with ErrClientClosed after
+// Close.
+func (c *Client) bind(ctx context.Context) (context.Context, func(), error) {
+	if c.ctx.Err() != nil {
+		return nil, nil, ErrClientClosed
+	}
+
+	var cancel context.CancelFunc
+	if c.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	stop := context.AfterFunc(c.ctx, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}, nil
 }
 
-func (c *Client) Uid() error {
-	return nil
+// responseBody returns the body of resp, decompressed when the server
+// gzipped it. Closing it doesn't close resp.Body.
+func responseBody(resp *http.Response) (io.ReadCloser, error) {
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		return ioutil.NopCloser(resp.Body), nil
+	}
+
+	zr, err := gzip.NewReader(resp.Body)
+	if err == io.EOF {
+		// Empty body, e.g. a 204 still labelled gzip
+		return ioutil.NopCloser(bytes.NewReader(nil)), nil
+	}
+	return zr, err
 }
 
-func (c *Client) Version() error {
-	return nil
+// Ping checks the server is reachable and accepts the client's credentials
+// with a cheap api/version call. When the credentials are refused the error
+// wraps ErrUnauthorized.
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.execRequest(ctx, "GET", "api/version", "", nil)
+	return err
+}
+
+type VersionInfo struct {
+	Version       string `json:"version"`
+	ShortRevision string `json:"short_revision"`
+	FullRevision  string `json:"full_revision"`
+	Timestamp     string `json:"timestamp"`
+	RepoStatus    string `json:"repo_status"`
+	Repo          string `json:"repo,omitempty"`
+	Host          string `json:"host"`
+	User          string `json:"user"`
+	Branch        string `json:"branch,omitempty"`
+}
+
+func (c *Client) Version() (*VersionInfo, error) {
+	return c.VersionContext(context.Background())
+}
+
+func (c *Client) VersionContext(ctx context.Context) (*VersionInfo, error) {
+
+	body, err := c.ExecRequestContext(ctx, "GET", "api/version", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &VersionInfo{}
+	if err := json.Unmarshal(body, v); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+
 }
@@ -1,6 +1,18 @@
 package opentsdb_test
 
 import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -8,13 +20,22 @@ import (
 )
 
 var testOptions = opentsdb.Options{
-	Host: "127.0.0.1",
-	Port: 4242,
+	Endpoint: "http://127.0.0.1:4242",
 }
 
 var testClient, _ = opentsdb.NewClient(testOptions)
 
+// requireServer skips tests that need a live OpenTSDB on the test endpoint
+func requireServer(t *testing.T) {
+	conn, err := net.DialTimeout("tcp", "127.0.0.1:4242", time.Second)
+	if err != nil {
+		t.Skip("no OpenTSDB server at 127.0.0.1:4242")
+	}
+	conn.Close()
+}
+
 func TestPut(t *testing.T) {
+	requireServer(t)
 	tim := time.Now().Unix()
 	p, _ := opentsdb.NewPoint("app-rankings.rank",
 		tim,
@@ -40,6 +61,7 @@ func TestPut(t *testing.T) {
 }
 
 func TestGet(t *testing.T) {
+	requireServer(t)
 	q, _ := opentsdb.NewQueryParams()
 	q.Start = "6h-ago"
 	q.Queries = append(q.Queries, opentsdb.Query{Aggregator: "sum", Metric: "app-rankings.rank"})
@@ -52,3 +74,2149 @@ func TestGet(t *testing.T) {
 		)
 	}
 }
+
+func TestConcurrentRequestPaths(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		// Put sends an array of points, Query a single object
+		expected := map[byte]string{'[': "/api/put", '{': "/api/query"}[body[0]]
+		if r.URL.Path != expected {
+			t.Error(
+				"Expected", expected,
+				"Got", r.URL.Path,
+			)
+		}
+		w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+
+	client, err := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, _ := opentsdb.NewPoint("metric", time.Now().Unix(), 1, map[string]string{"host": "a"})
+	bp := opentsdb.NewBatchPoints()
+	bp.AddPoint(p)
+
+	q, _ := opentsdb.NewQueryParams()
+	q.Start = "1h-ago"
+	q.Queries = append(q.Queries, opentsdb.Query{Aggregator: "sum", Metric: "metric"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := client.Put(bp, "details"); err != nil {
+				t.Error("Expected", nil, "Got", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := client.Query(q); err != nil {
+				t.Error("Expected", nil, "Got", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestRawQueryDoesNotLeak(t *testing.T) {
+	queries := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries[r.URL.Path] = r.URL.RawQuery
+		w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+
+	p, _ := opentsdb.NewPoint("metric", time.Now().Unix(), 1, map[string]string{"host": "a"})
+	bp := opentsdb.NewBatchPoints()
+	bp.AddPoint(p)
+	if _, err := client.Put(bp, "details"); err != nil {
+		t.Fatal(err)
+	}
+
+	q, _ := opentsdb.NewQueryParams()
+	q.Start = "1h-ago"
+	if _, err := client.Query(q); err != nil {
+		t.Fatal(err)
+	}
+
+	if queries["/api/put"] != "details" {
+		t.Error(
+			"Expected", "details",
+			"Got", queries["/api/put"],
+		)
+	}
+	if queries["/api/query"] != "" {
+		t.Error(
+			"Expected", "",
+			"Got", queries["/api/query"],
+		)
+	}
+}
+
+func TestExecRequestStatusCodes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/moved":
+			// No Location header so the http client doesn't follow it
+			w.WriteHeader(http.StatusMovedPermanently)
+			w.Write([]byte("moved"))
+		case "/bad":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"code":400,"message":"bad request"}}`))
+		case "/fail":
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("internal error"))
+		}
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+
+	body, err := client.ExecRequest("GET", "moved", nil)
+	if err != nil || string(body) != "moved" {
+		t.Error(
+			"Expected", "moved", nil,
+			"Got", string(body), err,
+		)
+	}
+
+	expected := "400: bad request"
+	_, err = client.ExecRequest("GET", "bad", nil)
+	if err == nil || err.Error() != expected {
+		t.Error(
+			"Expected", expected,
+			"Got", err,
+		)
+	}
+
+	expected = "opentsdb: server error: 500 Internal Server Error: internal error"
+	_, err = client.ExecRequest("GET", "fail", nil)
+	if err == nil || err.Error() != expected || !errors.Is(err, opentsdb.ErrServerError) {
+		t.Error(
+			"Expected", expected,
+			"Got", err,
+		)
+	}
+}
+
+func TestErrorSentinels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/denied":
+			w.WriteHeader(http.StatusUnauthorized)
+		case "/unavailable":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error":{"code":503,"message":"overloaded"}}`))
+		case "/bad":
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+
+	cases := map[string]error{
+		"missing":     opentsdb.ErrNotFound,
+		"denied":      opentsdb.ErrUnauthorized,
+		"unavailable": opentsdb.ErrServerError,
+	}
+	for path, sentinel := range cases {
+		_, err := client.ExecRequest("GET", path, nil)
+		if !errors.Is(err, sentinel) {
+			t.Error(
+				"Expected", sentinel, "for", path,
+				"Got", err,
+			)
+		}
+	}
+
+	_, err := client.ExecRequest("GET", "bad", nil)
+	if err == nil || errors.Is(err, opentsdb.ErrNotFound) || errors.Is(err, opentsdb.ErrServerError) {
+		t.Error(
+			"Expected", "error matching no sentinel",
+			"Got", err,
+		)
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":{"code":400,"message":"No such name for 'metrics': 'foo'",` +
+			`"details":"Unable to find metric","trace":"net.opentsdb.uid.NoSuchUniqueName"}}`))
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+
+	p, _ := opentsdb.NewPoint("foo", time.Now().Unix(), 1, map[string]string{"host": "a"})
+	bp := opentsdb.NewBatchPoints()
+	bp.AddPoint(p)
+
+	_, err := client.Put(bp, "")
+	apiErr, ok := err.(*opentsdb.APIError)
+	if !ok {
+		t.Fatal(
+			"Expected", "*opentsdb.APIError",
+			"Got", err,
+		)
+	}
+
+	if apiErr.Code != 400 || apiErr.Message != "No such name for 'metrics': 'foo'" ||
+		apiErr.Details != "Unable to find metric" || apiErr.Trace != "net.opentsdb.uid.NoSuchUniqueName" {
+		t.Error(
+			"Expected", "all fields decoded",
+			"Got", apiErr,
+		)
+	}
+}
+
+func TestSuggestInvalidBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"not":"an array"}`))
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+
+	values, err := client.Suggest(&opentsdb.SuggestParams{Type: "metrics", Match: "sys"})
+	if err == nil || values != nil {
+		t.Error(
+			"Expected", "error",
+			"Got", values, err,
+		)
+	}
+}
+
+func TestQueryContextCancel(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	q, _ := opentsdb.NewQueryParams()
+	q.Start = "1h-ago"
+	_, err := client.QueryContext(ctx, q)
+	if !errors.Is(err, context.Canceled) {
+		t.Error(
+			"Expected", context.Canceled,
+			"Got", err,
+		)
+	}
+}
+
+func TestContextVariantsCancel(t *testing.T) {
+	done := make(chan struct{})
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+
+	bp := opentsdb.NewBatchPoints()
+	p, _ := opentsdb.NewPoint("metric", 1500000000, 1, map[string]string{"host": "a"})
+	bp.AddPoint(p)
+
+	calls := map[string]func(ctx context.Context) error{
+		"GetAnnotationContext": func(ctx context.Context) error {
+			_, err := client.GetAnnotationContext(ctx, 1500000000, "")
+			return err
+		},
+		"PutWithDetailsContext": func(ctx context.Context) error {
+			_, err := client.PutWithDetailsContext(ctx, bp)
+			return err
+		},
+		"TreesContext": func(ctx context.Context) error {
+			_, err := client.TreesContext(ctx)
+			return err
+		},
+		"AssignUIDContext": func(ctx context.Context) error {
+			_, err := client.AssignUIDContext(ctx, &opentsdb.UIDAssignRequest{Metric: []string{"m"}})
+			return err
+		},
+		"SearchLookupContext": func(ctx context.Context) error {
+			_, err := client.SearchLookupContext(ctx, &opentsdb.SearchQuery{Metric: "m"})
+			return err
+		},
+		"StatsContext": func(ctx context.Context) error {
+			_, err := client.StatsContext(ctx)
+			return err
+		},
+	}
+	for name, call := range calls {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(20*time.Millisecond, cancel)
+		if err := call(ctx); !errors.Is(err, context.Canceled) {
+			t.Error(
+				"Expected", context.Canceled, "from", name,
+				"Got", err,
+			)
+		}
+	}
+
+	// Expect GetUIDMetasContext to stop sending lookups once ctx is done
+	mu.Lock()
+	requests = 0
+	mu.Unlock()
+	var refs []opentsdb.UIDRef
+	for i := 0; i < 20; i++ {
+		refs = append(refs, opentsdb.UIDRef{Type: "metric", UID: fmt.Sprintf("%06d", i)})
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	_, err := client.GetUIDMetasContext(ctx, refs)
+
+	var uidErrs *opentsdb.UIDMetaErrors
+	if !errors.As(err, &uidErrs) || !errors.Is(uidErrs.Errs[19], context.Canceled) {
+		t.Fatal(
+			"Expected", context.Canceled,
+			"Got", err,
+		)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if requests > 8 {
+		t.Error(
+			"Expected", "at most 8 requests",
+			"Got", requests,
+		)
+	}
+}
+
+func TestCustomHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for k, expected := range map[string]string{
+			"X-Tenant-ID":  "42",
+			"X-Extra":      "yes",
+			"Content-Type": "application/json",
+		} {
+			if got := r.Header.Get(k); got != expected {
+				t.Error(
+					"Expected", k, expected,
+					"Got", got,
+				)
+			}
+		}
+		w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{
+		Endpoint: server.URL,
+		Headers:  map[string]string{"X-Tenant-ID": "42", "Content-Type": "text/plain"},
+	})
+	client.AddHeader("X-Extra", "yes")
+
+	p, _ := opentsdb.NewPoint("metric", time.Now().Unix(), 1, map[string]string{"host": "a"})
+	bp := opentsdb.NewBatchPoints()
+	bp.AddPoint(p)
+	if _, err := client.Put(bp, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	q, _ := opentsdb.NewQueryParams()
+	q.Start = "1h-ago"
+	if _, err := client.Query(q); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompressPut(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Content-Encoding"); got != "gzip" {
+			t.Error(
+				"Expected", "gzip",
+				"Got", got,
+			)
+		}
+
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		body, _ := ioutil.ReadAll(zr)
+
+		expected := `[{"metric":"metric","timestamp":1500000000,"value":1,"tags":{"host":"a"}}]`
+		if string(body) != expected {
+			t.Error(
+				"Expected", expected,
+				"Got", string(body),
+			)
+		}
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL, CompressPut: true})
+
+	p, _ := opentsdb.NewPoint("metric", 1500000000, 1, map[string]string{"host": "a"})
+	bp := opentsdb.NewBatchPoints()
+	bp.AddPoint(p)
+	if _, err := client.Put(bp, ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGzipResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Accept-Encoding"); got != "gzip" {
+			t.Error(
+				"Expected", "gzip",
+				"Got", got,
+			)
+		}
+
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		zw.Write([]byte(`["sum","avg","zimsum"]`))
+		zw.Close()
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+
+	body, err := client.ExecRequest("GET", "api/aggregators", nil)
+	expected := `["sum","avg","zimsum"]`
+	if err != nil || string(body) != expected {
+		t.Error(
+			"Expected", expected,
+			"Got", string(body), err,
+		)
+	}
+
+	// Expect an empty body labelled gzip to be read as empty
+	empty := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer empty.Close()
+
+	client, _ = opentsdb.NewClient(opentsdb.Options{Endpoint: empty.URL})
+	if err := client.DeleteAnnotation(&opentsdb.Annotation{StartTime: 1500000000}); err != nil {
+		t.Error(
+			"Expected", nil,
+			"Got", err,
+		)
+	}
+}
+
+func TestPutChunked(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 2 {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+
+	bp := opentsdb.NewBatchPoints()
+	for i := 0; i < 5; i++ {
+		p, _ := opentsdb.NewPoint("metric", int64(1500000000+i), i, map[string]string{"host": "a"})
+		bp.AddPoint(p)
+	}
+
+	results, err := client.PutChunked(bp, 2, "")
+	if err == nil {
+		t.Error("Expected", "error", "Got", nil)
+	}
+
+	if len(results) != 3 {
+		t.Fatal("Expected", 3, "Got", len(results))
+	}
+	if results[0].Err != nil || results[1].Err == nil || results[2].Err != nil {
+		t.Error(
+			"Expected", "only the second chunk to fail",
+			"Got", results[0].Err, results[1].Err, results[2].Err,
+		)
+	}
+	if results[2].Offset != 4 || results[2].Size != 1 {
+		t.Error(
+			"Expected", 4, 1,
+			"Got", results[2].Offset, results[2].Size,
+		)
+	}
+}
+
+func TestPutWithDetails(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.RawQuery != "details" {
+			t.Error(
+				"Expected", "details",
+				"Got", r.URL.RawQuery,
+			)
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"success":1,"failed":1,"errors":[{"datapoint":{"metric":"bad.metric","timestamp":1500000000,` +
+			`"value":2,"tags":{"host":"a"}},"error":"Unable to find metric"}]}`))
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+
+	bp := opentsdb.NewBatchPoints()
+	p, _ := opentsdb.NewPoint("metric", 1500000000, 1, map[string]string{"host": "a"})
+	bp.AddPoint(p)
+	p, _ = opentsdb.NewPoint("bad.metric", 1500000000, 2, map[string]string{"host": "a"})
+	bp.AddPoint(p)
+
+	result, err := client.PutWithDetails(bp)
+	if err != nil || result.Success != 1 || result.Failed != 1 || len(result.Errors) != 1 {
+		t.Fatal(
+			"Expected", "1 success and 1 failure",
+			"Got", result, err,
+		)
+	}
+	if e := result.Errors[0]; e.Error != "Unable to find metric" || e.DataPoint.Metric != "bad.metric" || e.DataPoint.Tags["host"] != "a" {
+		t.Error(
+			"Expected", "bad.metric rejected",
+			"Got", e,
+		)
+	}
+}
+
+func TestPing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, password, _ := r.BasicAuth(); password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"version":"2.4.0"}`))
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL, Username: "user", Password: "secret"})
+	if err := client.Ping(context.Background()); err != nil {
+		t.Error(
+			"Expected", nil,
+			"Got", err,
+		)
+	}
+
+	client.SetPassword("wrong")
+	if err := client.Ping(context.Background()); !errors.Is(err, opentsdb.ErrUnauthorized) {
+		t.Error(
+			"Expected", opentsdb.ErrUnauthorized,
+			"Got", err,
+		)
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) != `{"start":"1h-ago"}` {
+			t.Error(
+				"Expected", `{"start":"1h-ago"}`,
+				"Got", string(body),
+			)
+		}
+
+		switch {
+		case r.URL.Path == "/api/query" && attempts < 3:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case r.URL.Path == "/bad":
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			w.Write([]byte("[]"))
+		}
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{
+		Endpoint:    server.URL,
+		RetryPolicy: opentsdb.RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond},
+	})
+
+	q, _ := opentsdb.NewQueryParams()
+	q.Start = "1h-ago"
+	if _, err := client.Query(q); err != nil || attempts != 3 {
+		t.Error(
+			"Expected", nil, 3,
+			"Got", err, attempts,
+		)
+	}
+
+	// Expect 4xx responses not to be retried
+	attempts = 0
+	if _, err := client.ExecRequest("POST", "bad", []byte(`{"start":"1h-ago"}`)); err == nil || attempts != 1 {
+		t.Error(
+			"Expected", "error", 1,
+			"Got", err, attempts,
+		)
+	}
+}
+
+func TestRetryPolicyManyRetries(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	// A base delay of 5s shifted by 31 overflows, expect the delay to stay
+	// capped at MaxDelay instead
+	client, _ := opentsdb.NewClient(opentsdb.Options{
+		Endpoint:    server.URL,
+		RetryPolicy: opentsdb.RetryPolicy{MaxRetries: 40, BaseDelay: 5 * time.Second, MaxDelay: time.Millisecond},
+	})
+
+	if err := client.Ping(context.Background()); err == nil || attempts != 41 {
+		t.Error(
+			"Expected", "error", 41,
+			"Got", err, attempts,
+		)
+	}
+}
+
+func TestEndpointsFailover(t *testing.T) {
+	badHits, goodHits := 0, 0
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		badHits++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer bad.Close()
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		goodHits++
+		w.Write([]byte("[]"))
+	}))
+	defer good.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{
+		Endpoints:   []string{bad.URL, good.URL},
+		RetryPolicy: opentsdb.RetryPolicy{MaxRetries: 1, BaseDelay: time.Millisecond},
+	})
+
+	for i := 0; i < 4; i++ {
+		if _, err := client.Aggregators(); err != nil {
+			t.Error(
+				"Expected", nil,
+				"Got", err,
+			)
+		}
+	}
+
+	// The failing endpoint is quarantined after its first error
+	if badHits != 1 || goodHits != 4 {
+		t.Error(
+			"Expected", 1, 4,
+			"Got", badHits, goodHits,
+		)
+	}
+}
+
+func TestQueryTypedShowFlags(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		for _, flag := range []string{`"showQuery":true`, `"showStats":true`, `"showTSUIDs":true`} {
+			if !strings.Contains(string(body), flag) {
+				t.Error(
+					"Expected", flag,
+					"Got", string(body),
+				)
+			}
+		}
+
+		w.Write([]byte(`[{"metric":"sys.cpu.user","tags":{},"aggregateTags":["host"],"dps":{"1500000000":1},` +
+			`"query":{"aggregator":"sum","metric":"sys.cpu.user","index":0},` +
+			`"stats":{"avgAggregationTime":0.5,"uidPairsResolved":2},` +
+			`"tsuids":["000001000001000001","000001000001000002"],"unknown":{"nested":[1]}},` +
+			`{"statsSummary":{"processingPreWriteTime":12.5,"queryIdx_00":{"emittedDPs":1}}}]`))
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+
+	q, _ := opentsdb.NewQueryParams()
+	q.Start = "1h-ago"
+	q.ShowQuery = true
+	q.ShowStats = true
+	q.ShowTSUIDs = true
+	results, err := client.QueryTyped(q)
+	if err != nil || len(results) != 2 {
+		t.Fatal(
+			"Expected", "2 results",
+			"Got", results, err,
+		)
+	}
+
+	r := results[0]
+	if r.Query == nil || r.Query.Aggregator != "sum" || len(r.TSUIDs) != 2 || r.Stats["uidPairsResolved"] == nil {
+		t.Error(
+			"Expected", "query, stats and tsuids",
+			"Got", r,
+		)
+	}
+	if results[1].StatsSummary == nil {
+		t.Error(
+			"Expected", "stats summary",
+			"Got", results[1],
+		)
+	}
+}
+
+func TestQueryTypedGlobalAnnotations(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if !strings.Contains(string(body), `"globalAnnotations":true`) {
+			t.Error(
+				"Expected", `"globalAnnotations":true`,
+				"Got", string(body),
+			)
+		}
+
+		w.Write([]byte(`[{"metric":"sys.cpu.user","tags":{},"dps":{"1500000000":1},` +
+			`"globalAnnotations":[{"startTime":1500000000,"description":"deploy v1.2"}]}]`))
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+
+	q, _ := opentsdb.NewQueryParams()
+	q.Start = "1h-ago"
+	q.GlobalAnnotations = true
+	results, err := client.QueryTyped(q)
+	if err != nil || len(results) != 1 || len(results[0].GlobalAnnotations) != 1 ||
+		results[0].GlobalAnnotations[0].Description != "deploy v1.2" {
+		t.Error(
+			"Expected", "one global annotation",
+			"Got", results, err,
+		)
+	}
+}
+
+func TestDeleteAnnotation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Method != "DELETE" || string(body) != `{"startTime":1500000000}` {
+			t.Error(
+				"Expected", "DELETE", `{"startTime":1500000000}`,
+				"Got", r.Method, string(body),
+			)
+		}
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":{"code":404,"message":"Unable to locate annotation in storage"}}`))
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+
+	err := client.DeleteAnnotation(&opentsdb.Annotation{StartTime: 1500000000, Description: "deploy"})
+	if !errors.Is(err, opentsdb.ErrNotFound) {
+		t.Error(
+			"Expected", opentsdb.ErrNotFound,
+			"Got", err,
+		)
+	}
+}
+
+func TestQueryDelete(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Method != "DELETE" || r.URL.Path != "/api/query" {
+			t.Error(
+				"Expected", "DELETE /api/query",
+				"Got", r.Method, r.URL.Path,
+			)
+		}
+		w.Write([]byte(`[{"metric":"a","tags":{"host":"x"},"dps":{"1500000000":1,"1500000060":2}},` +
+			`{"metric":"a","tags":{"host":"y"},"dps":{"1500000000":3}}]`))
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+
+	q, _ := opentsdb.NewQueryParams()
+	q.Start = "1h-ago"
+	q.Queries = []opentsdb.Query{{Aggregator: "none", Metric: "a"}}
+
+	// Expect failure if the delete isn't confirmed
+	if _, err := client.QueryDelete(q, opentsdb.DeleteOptions{}); err == nil || requests != 0 {
+		t.Error(
+			"Expected", "error and no request",
+			"Got", err, requests,
+		)
+	}
+
+	result, err := client.QueryDelete(q, opentsdb.DeleteOptions{Confirm: true})
+	if err != nil || len(result.Series) != 2 || result.DeletedPoints != 3 {
+		t.Error(
+			"Expected", "2 series and 3 points",
+			"Got", result, err,
+		)
+	}
+}
+
+func TestQueryDeleteArrays(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("arrays") != "true" {
+			t.Error(
+				"Expected", "arrays=true",
+				"Got", r.URL.RawQuery,
+			)
+		}
+		w.Write([]byte(`[{"metric":"a","tags":{"host":"x"},"dps":[[1500000000,1],[1500000060,{"p99":3}]]},` +
+			`{"metric":"a","tags":{"host":"y"},"dps":[[1500000000,3]]}]`))
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+
+	q, _ := opentsdb.NewQueryParams()
+	q.Start = "1h-ago"
+	q.Arrays = true
+	q.Queries = []opentsdb.Query{{Aggregator: "none", Metric: "a"}}
+
+	result, err := client.QueryDelete(q, opentsdb.DeleteOptions{Confirm: true})
+	if err != nil || len(result.Series) != 2 || result.DeletedPoints != 3 {
+		t.Error(
+			"Expected", "2 series and 3 points",
+			"Got", result, err,
+		)
+	}
+}
+
+func TestQueryStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/query":
+			w.Write([]byte(`[{"metric":"a","tags":{"host":"x"},"dps":{"1500000000":1}},` +
+				`{"metric":"a","tags":{"host":"y"},"dps":{"1500000000":9007199254740993}}]`))
+		}
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+
+	q, _ := opentsdb.NewQueryParams()
+	q.Start = "1h-ago"
+	it, err := client.QueryStream(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+
+	var hosts []string
+	for {
+		r, err := it.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		hosts = append(hosts, r.Tags["host"])
+	}
+
+	if len(hosts) != 2 || hosts[0] != "x" || hosts[1] != "y" {
+		t.Error(
+			"Expected", []string{"x", "y"},
+			"Got", hosts,
+		)
+	}
+
+	// Expect io.EOF again once drained
+	if _, err := it.Next(); err != io.EOF {
+		t.Error(
+			"Expected", io.EOF,
+			"Got", err,
+		)
+	}
+}
+
+func TestQueryStreamErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":{"code":400,"message":"No such name for 'metrics': 'foo'"}}`))
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+
+	q, _ := opentsdb.NewQueryParams()
+	q.Start = "1h-ago"
+	it, err := client.QueryStream(q)
+	if _, ok := err.(*opentsdb.APIError); !ok || it != nil {
+		t.Error(
+			"Expected", "*opentsdb.APIError",
+			"Got", it, err,
+		)
+	}
+}
+
+func TestCloseCancelsRequests(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+
+	q, _ := opentsdb.NewQueryParams()
+	q.Start = "1h-ago"
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := client.Query(q)
+		errs <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	client.Close()
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, opentsdb.ErrClientClosed) {
+			t.Error(
+				"Expected", opentsdb.ErrClientClosed,
+				"Got", err,
+			)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Close did not unblock the request")
+	}
+
+	// Expect calls after Close to fail right away
+	if _, err := client.Version(); !errors.Is(err, opentsdb.ErrClientClosed) {
+		t.Error(
+			"Expected", opentsdb.ErrClientClosed,
+			"Got", err,
+		)
+	}
+}
+
+func TestEndpointBasePath(t *testing.T) {
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Write([]byte(`{"version":"2.4.0"}`))
+	}))
+	defer server.Close()
+
+	cases := map[string]string{
+		server.URL:                      "/api/version",
+		server.URL + "/":                "/api/version",
+		server.URL + "/opentsdb":        "/opentsdb/api/version",
+		server.URL + "/opentsdb/":       "/opentsdb/api/version",
+		server.URL + "//tsd//opentsdb/": "/tsd/opentsdb/api/version",
+	}
+	for endpoint, expected := range cases {
+		client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: endpoint})
+		if _, err := client.Version(); err != nil || path != expected {
+			t.Error(
+				"Expected", expected, "for", endpoint,
+				"Got", path, err,
+			)
+		}
+	}
+}
+
+func TestHooks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/put" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+
+	var mu sync.Mutex
+	var calls []string
+	client, _ := opentsdb.NewClient(opentsdb.Options{
+		Endpoint: server.URL,
+		OnRequest: func(method, path, requestID string) {
+			mu.Lock()
+			calls = append(calls, "request "+method+" "+path)
+			mu.Unlock()
+		},
+		OnResponse: func(method, path, requestID string, status int, dur time.Duration, err error) {
+			mu.Lock()
+			calls = append(calls, fmt.Sprint("response ", method, " ", path, " ", status, " ", err != nil))
+			mu.Unlock()
+		},
+	})
+
+	client.Aggregators()
+
+	p, _ := opentsdb.NewPoint("metric", time.Now().Unix(), 1, map[string]string{"host": "a"})
+	bp := opentsdb.NewBatchPoints()
+	bp.AddPoint(p)
+	client.Put(bp, "")
+
+	expected := []string{
+		"request GET api/aggregators",
+		"response GET api/aggregators 200 false",
+		"request POST api/put",
+		"response POST api/put 400 false",
+	}
+	if fmt.Sprint(calls) != fmt.Sprint(expected) {
+		t.Error(
+			"Expected", expected,
+			"Got", calls,
+		)
+	}
+
+	// Expect no panic without hooks
+	client, _ = opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+	client.Aggregators()
+}
+
+func TestRateLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL, RateLimit: 20})
+
+	p, _ := opentsdb.NewPoint("metric", time.Now().Unix(), 1, map[string]string{"host": "a"})
+	bp := opentsdb.NewBatchPoints()
+	bp.AddPoint(p)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := client.Put(bp, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Error(
+			"Expected", "at least 90ms",
+			"Got", elapsed,
+		)
+	}
+
+	// Expect failure when the wait outlasts the context
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := client.PutContext(ctx, bp, ""); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error(
+			"Expected", context.DeadlineExceeded,
+			"Got", err,
+		)
+	}
+
+	// Expect a burst to go through at once
+	client, _ = opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL, RateLimit: 1, RateBurst: 3})
+	start = time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := client.Put(bp, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Error(
+			"Expected", "less than 500ms",
+			"Got", elapsed,
+		)
+	}
+}
+
+func TestRateLimitCancel(t *testing.T) {
+	var mu sync.Mutex
+	var arrivals []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		arrivals = append(arrivals, time.Now())
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL, RateLimit: 10})
+
+	p, _ := opentsdb.NewPoint("metric", time.Now().Unix(), 1, map[string]string{"host": "a"})
+	bp := opentsdb.NewBatchPoints()
+	bp.AddPoint(p)
+
+	put := func(ctx context.Context, wg *sync.WaitGroup) {
+		defer wg.Done()
+		client.PutContext(ctx, bp, "")
+	}
+
+	// Expect a canceled waiter not to make the ones queued after it share
+	// a turn with a later caller
+	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(context.Background())
+	wg.Add(4)
+	go put(context.Background(), &wg)
+	time.Sleep(10 * time.Millisecond)
+	go put(ctx, &wg)
+	time.Sleep(10 * time.Millisecond)
+	go put(context.Background(), &wg)
+	time.Sleep(10 * time.Millisecond)
+	go put(context.Background(), &wg)
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	wg.Add(1)
+	go put(context.Background(), &wg)
+	wg.Wait()
+
+	if len(arrivals) != 4 {
+		t.Fatal(
+			"Expected", 4,
+			"Got", len(arrivals),
+		)
+	}
+	for i := 1; i < len(arrivals); i++ {
+		if gap := arrivals[i].Sub(arrivals[i-1]); gap < 80*time.Millisecond {
+			t.Error(
+				"Expected", "at least 80ms between requests",
+				"Got", gap, "before request", i,
+			)
+		}
+	}
+}
+
+func TestRateLimitRetries(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{
+		Endpoint:    server.URL,
+		RateLimit:   10,
+		RetryPolicy: opentsdb.RetryPolicy{MaxRetries: 1, BaseDelay: time.Millisecond},
+	})
+
+	p, _ := opentsdb.NewPoint("metric", time.Now().Unix(), 1, map[string]string{"host": "a"})
+	bp := opentsdb.NewBatchPoints()
+	bp.AddPoint(p)
+
+	// Expect the retry to wait for its own turn
+	start := time.Now()
+	if _, err := client.Put(bp, ""); err != nil || attempts != 2 {
+		t.Fatal(
+			"Expected", nil, 2,
+			"Got", err, attempts,
+		)
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Error(
+			"Expected", "at least 90ms",
+			"Got", elapsed,
+		)
+	}
+}
+
+type mapCache struct {
+	mu   sync.Mutex
+	vals map[string][]byte
+}
+
+func (m *mapCache) Get(key string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	val, ok := m.vals[key]
+	return val, ok
+}
+
+func (m *mapCache) Set(key string, val []byte, ttl time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.vals[key] = val
+}
+
+func TestQueryCache(t *testing.T) {
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+
+	cache := &mapCache{vals: map[string][]byte{}}
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL, Cache: cache})
+
+	cases := []struct {
+		end      interface{}
+		expected int
+	}{
+		{1500000000, 1},
+		{"2017/07/14-02:40:00", 1},
+		{nil, 2},
+		{"1h-ago", 2},
+		{time.Now().Add(time.Hour).Unix(), 2},
+	}
+	for _, c := range cases {
+		hits = 0
+		q, _ := opentsdb.NewQueryParams()
+		q.Start = "2017/07/01-00:00:00"
+		q.End = c.end
+		for i := 0; i < 2; i++ {
+			if _, err := client.Query(q); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if hits != c.expected {
+			t.Error(
+				"Expected", c.expected, "requests for end", c.end,
+				"Got", hits,
+			)
+		}
+	}
+}
+
+func TestQueryCacheShared(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"metric":"` + r.Header.Get("X-Tenant-ID") + `","tags":{},"dps":{}}]`))
+	}))
+	defer server.Close()
+
+	cache := &mapCache{vals: map[string][]byte{}}
+	q, _ := opentsdb.NewQueryParams()
+	q.Start = "2017/07/01-00:00:00"
+	q.End = 1500000000
+
+	// Expect clients of different tenants not to share cached responses
+	for _, tenant := range []string{"a", "b"} {
+		client, _ := opentsdb.NewClient(opentsdb.Options{
+			Endpoint: server.URL,
+			Cache:    cache,
+			Headers:  map[string]string{"X-Tenant-ID": tenant},
+		})
+		body, err := client.Query(q)
+		expected := `[{"metric":"` + tenant + `","tags":{},"dps":{}}]`
+		if err != nil || string(body) != expected {
+			t.Error(
+				"Expected", expected,
+				"Got", string(body), err,
+			)
+		}
+	}
+	if len(cache.vals) != 2 {
+		t.Error(
+			"Expected", 2,
+			"Got", len(cache.vals),
+		)
+	}
+}
+
+func TestThreadStatsUnavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+
+	_, err := client.ThreadStats()
+	if !errors.Is(err, opentsdb.ErrNotFound) || !strings.HasPrefix(err.Error(), "StatsError: thread stats unavailable") {
+		t.Error(
+			"Expected", opentsdb.ErrNotFound,
+			"Got", err,
+		)
+	}
+}
+
+func TestQueryStats(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"running":[],"completed":[{"query":{"start":"1h-ago","queries":[{"aggregator":"sum","metric":"sys.cpu.user"}]},` +
+			`"user":null,"remote":"10.0.0.1:50000","queryStartTimestamp":1500000000000,"queryCompletedTimestamp":1500000000250,` +
+			`"executed":2,"exception":"null","httpResponse":{"code":200,"reasonPhrase":"OK"},` +
+			`"stats":{"rowsPreFilter":12,"successfulScan":3},"newField":{"a":1}}],"summary":{"avgQueryTime":12.5}}`))
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+
+	stats, err := client.QueryStats()
+	if err != nil || len(stats.Completed) != 1 {
+		t.Fatal(
+			"Expected", "1 completed query",
+			"Got", stats, err,
+		)
+	}
+
+	s := stats.Completed[0]
+	if s.Query == nil || s.Query.Queries[0].Metric != "sys.cpu.user" || s.Remote != "10.0.0.1:50000" ||
+		s.Executed != 2 || s.HTTPResponse.Code != 200 || s.Stats["rowsPreFilter"] == nil {
+		t.Error(
+			"Expected", "completed query decoded",
+			"Got", s,
+		)
+	}
+	if string(s.Raw["newField"]) != `{"a":1}` || stats.Raw["summary"] == nil {
+		t.Error(
+			"Expected", "raw fields kept",
+			"Got", s.Raw, stats.Raw,
+		)
+	}
+}
+
+func TestQueryLastParams(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+		w.Write([]byte(`[{"metric":"sys.cpu.user","tags":{"host":"a"},"tsuid":"000001000001000001",` +
+			`"timestamp":1500000000000,"value":"42"}]`))
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+
+	q := &opentsdb.LastQueryParams{
+		Queries:      []opentsdb.LastQuery{{TSUIDs: []string{"000001000001000001"}}},
+		ResolveNames: true,
+		BackScan:     24,
+	}
+	points, err := client.QueryLast(q)
+	expected := `{"queries":[{"tsuids":["000001000001000001"]}],"resolveNames":true,"backScan":24}`
+	if err != nil || body != expected {
+		t.Error(
+			"Expected", expected,
+			"Got", body, err,
+		)
+	}
+	if len(points) != 1 || points[0].Metric != "sys.cpu.user" || points[0].Value != "42" {
+		t.Error(
+			"Expected", "resolved point",
+			"Got", points,
+		)
+	}
+}
+
+func TestCreateUpdateTree(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`{"treeId":1,"name":"test"}`))
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+
+	// Expect failure without a request when the TreeId doesn't fit the call
+	if _, err := client.CreateTree(&opentsdb.Tree{TreeId: 1, Name: "test"}); err == nil || requests != 0 {
+		t.Error(
+			"Expected", "error and no request",
+			"Got", err, requests,
+		)
+	}
+	if _, err := client.UpdateTree(&opentsdb.Tree{Name: "test"}); err == nil || requests != 0 {
+		t.Error(
+			"Expected", "error and no request",
+			"Got", err, requests,
+		)
+	}
+
+	tree, err := client.CreateTree(&opentsdb.Tree{Name: "test"})
+	if err != nil || tree.TreeId != 1 {
+		t.Error(
+			"Expected", 1,
+			"Got", tree, err,
+		)
+	}
+	if _, err := client.UpdateTree(tree); err != nil || requests != 2 {
+		t.Error(
+			"Expected", nil, 2,
+			"Got", err, requests,
+		)
+	}
+}
+
+func TestAssignUID(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) == `{"metric":["bad"]}` {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"code":400,"message":"Unable to parse request"}}`))
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"metric":{"sys.cpu.user":"000001"},"metric_errors":{"sys.cpu.idle":"Name already exists with UID: 000002"}}`))
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+
+	// Expect the partial report of a 400 to be returned without an error
+	result, err := client.AssignUID(&opentsdb.UIDAssignRequest{Metric: []string{"sys.cpu.user", "sys.cpu.idle"}})
+	if err != nil || result.Metric["sys.cpu.user"] != "000001" || !result.HasErrors() ||
+		result.MetricErrors["sys.cpu.idle"] != "Name already exists with UID: 000002" {
+		t.Error(
+			"Expected", "1 assigned and 1 failed metric",
+			"Got", result, err,
+		)
+	}
+
+	// Expect a 400 that isn't a report to be an error
+	if _, err := client.AssignUID(&opentsdb.UIDAssignRequest{Metric: []string{"bad"}}); err == nil {
+		t.Error(
+			"Expected", "error",
+			"Got", nil,
+		)
+	}
+}
+
+func TestDeleteUID(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" || r.URL.Path != "/api/uid/assign" {
+			t.Error(
+				"Expected", "DELETE /api/uid/assign",
+				"Got", r.Method, r.URL.Path,
+			)
+		}
+		switch r.URL.Query().Get("metric") {
+		case "test.metric":
+			w.Write([]byte(`{"metric":{"test.metric":"000042"}}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"metric_errors":{"gone.metric":"No such name for 'metrics': 'gone.metric'"}}`))
+		}
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+
+	if err := client.DeleteUID("metric", "test.metric"); err != nil {
+		t.Error(
+			"Expected", nil,
+			"Got", err,
+		)
+	}
+
+	if err := client.DeleteUID("metric", "gone.metric"); !errors.Is(err, opentsdb.ErrNotFound) {
+		t.Error(
+			"Expected", opentsdb.ErrNotFound,
+			"Got", err,
+		)
+	}
+
+	// Expect failure on an unknown type, without a request
+	if err := client.DeleteUID("metrics", "test.metric"); err == nil {
+		t.Error(
+			"Expected", "error",
+			"Got", nil,
+		)
+	}
+}
+
+func TestQueryRaw(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Timing", "12ms")
+		w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+
+	q, _ := opentsdb.NewQueryParams()
+	q.Start = "1h-ago"
+	resp, err := client.QueryRaw(q)
+	if err != nil || resp.StatusCode != http.StatusOK || resp.Header.Get("X-Timing") != "12ms" || string(resp.Body) != "[]" {
+		t.Error(
+			"Expected", "200 with X-Timing and body",
+			"Got", resp, err,
+		)
+	}
+}
+
+func TestDeleteSeries(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+		w.Write([]byte(`[{"metric":"bad.metric","tags":{"host":"a"},"dps":{"1500000000":1,"1500000060":2}}]`))
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+
+	n, err := client.DeleteSeries("bad.metric", map[string]string{"host": "a"}, "2017/07/14-00:00:00", "")
+	expected := `{"start":"2017/07/14-00:00:00","queries":[{"aggregator":"none","metric":"bad.metric","tags":{"host":"a"}}]}`
+	if err != nil || n != 2 || body != expected {
+		t.Error(
+			"Expected", 2, expected,
+			"Got", n, body, err,
+		)
+	}
+}
+
+func TestSuggestDetailed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`["sys.cpu.idle","sys.cpu.user"]`))
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+
+	cases := map[int]bool{2: true, 10: false, 0: false}
+	for max, truncated := range cases {
+		result, err := client.SuggestDetailed(&opentsdb.SuggestParams{Type: opentsdb.SuggestTypeMetrics, Match: "sys.cpu", Max: max})
+		if err != nil || len(result.Values) != 2 || result.Truncated != truncated {
+			t.Error(
+				"Expected", truncated, "for max", max,
+				"Got", result, err,
+			)
+		}
+	}
+}
+
+func TestQueryTypedNoData(t *testing.T) {
+	cases := map[string]func(w http.ResponseWriter){
+		"empty array": func(w http.ResponseWriter) {
+			w.Write([]byte("[]"))
+		},
+		"empty body": func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusNoContent)
+		},
+	}
+	for name, handler := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handler(w)
+		}))
+		client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+
+		q, _ := opentsdb.NewQueryParams()
+		q.Start = "1h-ago"
+		results, err := client.QueryTyped(q)
+		if err != nil || results == nil || len(results) != 0 {
+			t.Error(
+				"Expected", "empty results for", name,
+				"Got", results, err,
+			)
+		}
+		server.Close()
+	}
+}
+
+func TestQueryTypedNoSuchName(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":{"code":400,"message":"No such name for 'metrics': 'nope'",` +
+			`"details":"No such name for 'metrics': 'nope'"}}`))
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+
+	q, _ := opentsdb.NewQueryParams()
+	q.Start = "1h-ago"
+	q.Queries = []opentsdb.Query{{Aggregator: "sum", Metric: "nope"}}
+	results, err := client.QueryTyped(q)
+
+	var apiErr *opentsdb.APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != 400 || apiErr.Message != "No such name for 'metrics': 'nope'" || results != nil {
+		t.Error(
+			"Expected", "*opentsdb.APIError",
+			"Got", results, err,
+		)
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(100 * time.Millisecond):
+		}
+		w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+
+	q, _ := opentsdb.NewQueryParams()
+	q.Start = "1h-ago"
+	if _, err := client.WithTimeout(20 * time.Millisecond).Query(q); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error(
+			"Expected", context.DeadlineExceeded,
+			"Got", err,
+		)
+	}
+
+	// Expect the shared client to be left without a deadline
+	if _, err := client.Query(q); err != nil {
+		t.Error(
+			"Expected", nil,
+			"Got", err,
+		)
+	}
+}
+
+func TestSuggestParamsOmitEmpty(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+		w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+
+	cases := map[string]*opentsdb.SuggestParams{
+		`{"type":"metrics"}`:                  {Type: opentsdb.SuggestTypeMetrics},
+		`{"type":"tagk","q":"ho"}`:            {Type: opentsdb.SuggestTypeTagK, Match: "ho"},
+		`{"type":"tagv","q":"web","max":100}`: {Type: opentsdb.SuggestTypeTagV, Match: "web", Max: 100},
+	}
+	for expected, params := range cases {
+		if _, err := client.Suggest(params); err != nil || body != expected {
+			t.Error(
+				"Expected", expected,
+				"Got", body, err,
+			)
+		}
+	}
+}
+
+func TestQueryBatch(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+
+		body, _ := ioutil.ReadAll(r.Body)
+		if strings.Contains(string(body), "bad") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`[{"metric":"m","tags":{},"dps":{}}]`))
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+
+	queries := make([]*opentsdb.QueryParams, 7)
+	for i := range queries {
+		queries[i] = &opentsdb.QueryParams{Start: "1h-ago", Queries: []opentsdb.Query{{Aggregator: "sum", Metric: "m"}}}
+	}
+	queries[4].Queries[0].Metric = "bad"
+
+	results, err := client.QueryBatch(context.Background(), queries, 3, false)
+	if err == nil || len(results) != 7 || maxInFlight > 3 {
+		t.Fatal(
+			"Expected", "error, 7 results and at most 3 in flight",
+			"Got", err, len(results), maxInFlight,
+		)
+	}
+	for i, r := range results {
+		if r.Index != i || (i == 4) != (r.Err != nil) {
+			t.Error(
+				"Expected", "only query 4 to fail",
+				"Got", i, r,
+			)
+		}
+	}
+
+	// Expect the queries after the failure to be canceled with failFast
+	results, _ = client.QueryBatch(context.Background(), queries[4:], 1, true)
+	if !errors.Is(results[2].Err, context.Canceled) {
+		t.Error(
+			"Expected", context.Canceled,
+			"Got", results[2].Err,
+		)
+	}
+}
+
+func TestQueryTypedArrays(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("arrays") != "true" {
+			t.Error(
+				"Expected", "arrays=true",
+				"Got", r.URL.RawQuery,
+			)
+		}
+		w.Write([]byte(`[{"metric":"m","tags":{},"dps":[[1500000000,1],[1500000060,9007199254740993],[1500000120,{"p99":3}]]}]`))
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+
+	q, _ := opentsdb.NewQueryParams()
+	q.Start = "1h-ago"
+	q.Arrays = true
+	results, err := client.QueryTyped(q)
+	if err != nil || len(results) != 1 {
+		t.Fatal(
+			"Expected", "1 result",
+			"Got", results, err,
+		)
+	}
+
+	points, err := results[0].DataPoints()
+	if err != nil || len(points) != 3 {
+		t.Fatal(
+			"Expected", "3 points",
+			"Got", points, err,
+		)
+	}
+	if v, _ := points[1].Int64(); points[0].Value != 1 || v != 9007199254740993 || string(points[2].RawValue) != `{"p99":3}` {
+		t.Error(
+			"Expected", "points decoded from arrays",
+			"Got", points,
+		)
+	}
+}
+
+func TestMetricExists(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		switch {
+		case strings.Contains(string(body), `"q":"sys.cpu.user"`):
+			w.Write([]byte(`["sys.cpu.user"]`))
+		case strings.Contains(string(body), `"q":"sys.cpu"`):
+			w.Write([]byte(`["sys.cpu.idle"]`))
+		default:
+			w.Write([]byte(`[]`))
+		}
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+
+	cases := map[string]bool{"sys.cpu.user": true, "sys.cpu": false, "nope": false}
+	for metric, expected := range cases {
+		if exists, err := client.MetricExists(metric); err != nil || exists != expected {
+			t.Error(
+				"Expected", expected, "for", metric,
+				"Got", exists, err,
+			)
+		}
+	}
+}
+
+func TestDisableKeepAlives(t *testing.T) {
+	var mu sync.Mutex
+	conns := map[string]bool{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		conns[r.RemoteAddr] = true
+		mu.Unlock()
+		w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL, DisableKeepAlives: true})
+	for i := 0; i < 3; i++ {
+		if _, err := client.Aggregators(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(conns) != 3 {
+		t.Error(
+			"Expected", "3 connections",
+			"Got", len(conns),
+		)
+	}
+}
+
+func TestProxy(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Host != "tsd.internal:4242" {
+			t.Error(
+				"Expected", "tsd.internal:4242",
+				"Got", r.URL.Host,
+			)
+		}
+		w.Write([]byte(`["sum"]`))
+	}))
+	defer proxy.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	client, _ := opentsdb.NewClient(opentsdb.Options{
+		Endpoint: "http://tsd.internal:4242",
+		Proxy:    http.ProxyURL(proxyURL),
+	})
+
+	aggregators, err := client.Aggregators()
+	if err != nil || len(aggregators) != 1 || aggregators[0] != "sum" {
+		t.Error(
+			"Expected", []string{"sum"},
+			"Got", aggregators, err,
+		)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL + "/tsd", DryRun: true})
+
+	q, _ := opentsdb.NewQueryParams()
+	q.Start = "1h-ago"
+	q.Arrays = true
+	_, err := client.Query(q)
+
+	var prepared *opentsdb.PreparedRequest
+	if !errors.As(err, &prepared) || !errors.Is(err, opentsdb.ErrDryRun) {
+		t.Fatal(
+			"Expected", "*opentsdb.PreparedRequest",
+			"Got", err,
+		)
+	}
+
+	if prepared.Method != "POST" || prepared.URL != server.URL+"/tsd/api/query?arrays=true" ||
+		string(prepared.Body) != `{"start":"1h-ago"}` || prepared.Header.Get("Content-Type") != "application/json" {
+		t.Error(
+			"Expected", "POST "+server.URL+`/tsd/api/query?arrays=true {"start":"1h-ago"}`,
+			"Got", prepared.Method, prepared.URL, string(prepared.Body), prepared.Header,
+		)
+	}
+
+	if hits != 0 {
+		t.Error(
+			"Expected", 0,
+			"Got", hits,
+		)
+	}
+}
+
+func TestMaxResponseBytes(t *testing.T) {
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Write([]byte(`["` + strings.Repeat("a", 100) + `"]`))
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{
+		Endpoint:         server.URL,
+		MaxResponseBytes: 64,
+		RetryPolicy:      opentsdb.RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond},
+	})
+	if _, err := client.Aggregators(); !errors.Is(err, opentsdb.ErrResponseTooLarge) || hits != 1 {
+		t.Error(
+			"Expected", opentsdb.ErrResponseTooLarge, "after 1 request",
+			"Got", err, hits,
+		)
+	}
+
+	client, _ = opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL, MaxResponseBytes: 104})
+	if _, err := client.Aggregators(); err != nil {
+		t.Error(
+			"Expected", nil,
+			"Got", err,
+		)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var mu sync.Mutex
+	var ids []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ids = append(ids, r.Header.Get(opentsdb.RequestIDHeader))
+		attempt := len(ids)
+		mu.Unlock()
+		if attempt == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+
+	var hookID string
+	client, _ := opentsdb.NewClient(opentsdb.Options{
+		Endpoint:    server.URL,
+		RetryPolicy: opentsdb.RetryPolicy{MaxRetries: 1, BaseDelay: time.Millisecond},
+		OnResponse: func(method, path, requestID string, status int, dur time.Duration, err error) {
+			hookID = requestID
+		},
+	})
+
+	client.Aggregators()
+	client.Aggregators()
+
+	// Expect the retry to reuse the ID and the next call to get a new one
+	if len(ids) != 3 || ids[0] == "" || ids[0] != ids[1] || ids[1] == ids[2] || hookID != ids[2] {
+		t.Error(
+			"Expected", "one ID per call, shared by its retries, also passed to the hook",
+			"Got", ids, hookID,
+		)
+	}
+}
+
+func TestQueryMap(t *testing.T) {
+	duplicate := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		series := `{"metric":"sys.cpu.user","tags":{"host":"a","dc":"eu"},"dps":{"1500000060":2,"1500000000":1}}`
+		if duplicate {
+			w.Write([]byte("[" + series + "," + series + "]"))
+			return
+		}
+		w.Write([]byte("[" + series + `,{"metric":"sys.cpu.user","tags":{},"dps":{}}]`))
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+
+	q, _ := opentsdb.NewQueryParams()
+	q.Start = "1h-ago"
+	series, err := client.QueryMap(q)
+	if err != nil || len(series) != 2 {
+		t.Fatal(
+			"Expected", "2 series",
+			"Got", series, err,
+		)
+	}
+
+	points := series["sys.cpu.user{dc=eu,host=a}"]
+	if len(points) != 2 || points[0].Timestamp != 1500000000 || series["sys.cpu.user{}"] == nil {
+		t.Error(
+			"Expected", "ordered points keyed by series",
+			"Got", series,
+		)
+	}
+
+	// Expect failure when a series comes back twice
+	duplicate = true
+	if _, err := client.QueryMap(q); err == nil {
+		t.Error(
+			"Expected", "error",
+			"Got", nil,
+		)
+	}
+}
+
+func TestRequestInterceptor(t *testing.T) {
+	sign := func(method, path string, body []byte) string {
+		return fmt.Sprintf("%s %s %d", method, path, len(body))
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if expected := sign(r.Method, r.URL.Path, body); r.Header.Get("X-Signature") != expected {
+			t.Error(
+				"Expected", expected,
+				"Got", r.Header.Get("X-Signature"),
+			)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{
+		Endpoint: server.URL,
+		RequestInterceptor: func(req *http.Request) error {
+			var body []byte
+			if req.GetBody != nil {
+				rc, err := req.GetBody()
+				if err != nil {
+					return err
+				}
+				body, _ = ioutil.ReadAll(rc)
+			}
+			req.Header.Set("X-Signature", sign(req.Method, req.URL.Path, body))
+			return nil
+		},
+	})
+
+	p, _ := opentsdb.NewPoint("metric", time.Now().Unix(), 1, map[string]string{"host": "a"})
+	bp := opentsdb.NewBatchPoints()
+	bp.AddPoint(p)
+	if _, err := client.Put(bp, ""); err != nil {
+		t.Error(
+			"Expected", nil,
+			"Got", err,
+		)
+	}
+	if _, err := client.ExecRequest("GET", "api/version", nil); err != nil {
+		t.Error(
+			"Expected", nil,
+			"Got", err,
+		)
+	}
+
+	// Expect an interceptor error to abort the request
+	errSign := errors.New("no key")
+	client, _ = opentsdb.NewClient(opentsdb.Options{
+		Endpoint:           server.URL,
+		RequestInterceptor: func(req *http.Request) error { return errSign },
+	})
+	if _, err := client.ExecRequest("GET", "api/version", nil); !errors.Is(err, errSign) {
+		t.Error(
+			"Expected", errSign,
+			"Got", err,
+		)
+	}
+}
+
+func TestChunkedQueryResponse(t *testing.T) {
+	var series []string
+	for i := 0; i < 200; i++ {
+		series = append(series, fmt.Sprintf(`{"metric":"m","tags":{"host":"h%d"},"dps":{"1500000000":%d}}`, i, i))
+	}
+	response := "[" + strings.Join(series, ",") + "]"
+
+	gzipped := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var out io.Writer = w
+		var zw *gzip.Writer
+		if gzipped {
+			w.Header().Set("Content-Encoding", "gzip")
+			zw = gzip.NewWriter(w)
+			out = zw
+		}
+
+		// Flushing before the end makes the server send chunks
+		for i := 0; i < len(response); i += 512 {
+			end := i + 512
+			if end > len(response) {
+				end = len(response)
+			}
+			out.Write([]byte(response[i:end]))
+			if zw != nil {
+				zw.Flush()
+			}
+			w.(http.Flusher).Flush()
+		}
+		if zw != nil {
+			zw.Close()
+		}
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+
+	for _, gzipped = range []bool{false, true} {
+		q, _ := opentsdb.NewQueryParams()
+		q.Start = "1h-ago"
+
+		resp, err := client.QueryRaw(q)
+		if err != nil || string(resp.Body) != response || resp.Header.Get("Content-Length") != "" {
+			t.Error(
+				"Expected", len(response), "bytes in chunks, gzipped", gzipped,
+				"Got", resp, err,
+			)
+		}
+	}
+}
+
+func TestQuerySimple(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+		w.Write([]byte(`[{"metric":"sys.cpu.user","tags":{"host":"a"},"dps":{"1500000000":1}}]`))
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+
+	results, err := client.QuerySimple("sys.cpu.user", "avg", "1h-ago", "", map[string]string{"host": "*"})
+	expected := `{"start":"1h-ago","queries":[{"aggregator":"avg","metric":"sys.cpu.user","tags":{"host":"*"}}]}`
+	if err != nil || len(results) != 1 || body != expected {
+		t.Error(
+			"Expected", expected,
+			"Got", body, results, err,
+		)
+	}
+
+	// Expect failure without a start
+	if _, err := client.QuerySimple("sys.cpu.user", "avg", "", "", nil); err == nil {
+		t.Error(
+			"Expected", "error",
+			"Got", nil,
+		)
+	}
+}
+
+func TestGetUIDMetas(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uid := r.URL.Query().Get("uid")
+		if uid == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, `{"uid":%q,"type":%q,"name":"name-%s"}`, uid, strings.ToUpper(r.URL.Query().Get("type")), uid)
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+
+	var refs []opentsdb.UIDRef
+	for i := 0; i < 20; i++ {
+		refs = append(refs, opentsdb.UIDRef{Type: "metric", UID: fmt.Sprintf("%06d", i)})
+	}
+	refs[7].UID = "missing"
+
+	metas, err := client.GetUIDMetas(refs)
+
+	var uidErrs *opentsdb.UIDMetaErrors
+	if !errors.As(err, &uidErrs) || !errors.Is(err, opentsdb.ErrNotFound) || uidErrs.Errs[7] == nil {
+		t.Fatal(
+			"Expected", "lookup 7 to fail with ErrNotFound",
+			"Got", err,
+		)
+	}
+
+	for i, meta := range metas {
+		if i == 7 {
+			continue
+		}
+		if meta.UID != refs[i].UID || meta.Name != "name-"+refs[i].UID || uidErrs.Errs[i] != nil {
+			t.Error(
+				"Expected", refs[i].UID,
+				"Got", meta, uidErrs.Errs[i],
+			)
+		}
+	}
+}
@@ -3,8 +3,11 @@ package opentsdb
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"reflect"
+	"strings"
 	"sync"
+	"unicode"
 )
 
 type Point struct {
@@ -52,22 +55,187 @@ func NewPoint(metric string, timestamp int64, value interface{}, tags map[string
 type BatchPoints struct {
 	sync.Mutex
 	Points []*Point `json:""`
+
+	// Timestamps of the points are unix milliseconds instead of seconds
+	MillisecondTimestamps bool `json:"-"`
+}
+
+const (
+	// OpenTSDB reads any timestamp that fits in 32 bits as seconds and
+	// anything larger as milliseconds, up to 13 digits
+	maxSecondTimestamp      = 1<<32 - 1
+	maxMillisecondTimestamp = 9999999999999
+)
+
+// validateTimestamp rejects timestamps OpenTSDB would read in the other
+// resolution, e.g. milliseconds sent as seconds
+func validateTimestamp(ts int64, ms bool) error {
+	if ts <= 0 {
+		return fmt.Errorf("PointError: timestamp %d must be positive", ts)
+	}
+
+	if ms {
+		if ts <= maxSecondTimestamp || ts > maxMillisecondTimestamp {
+			return fmt.Errorf("PointError: timestamp %d is not a plausible millisecond timestamp", ts)
+		}
+		return nil
+	}
+
+	if ts > maxSecondTimestamp {
+		return fmt.Errorf("PointError: timestamp %d is not a plausible second timestamp, set MillisecondTimestamps for millisecond batches", ts)
+	}
+	return nil
 }
 
 func NewBatchPoints() *BatchPoints {
 	return new(BatchPoints)
 }
 
-func (bp *BatchPoints) AddPoint(p *Point) {
+// ValidatePoint checks p against the rules OpenTSDB applies on write: a
+// metric and at least one tag, with names made of letters, digits and
+// "-_./" only
+func ValidatePoint(p Point) error {
+	if p.Metric == "" {
+		return errors.New("PointError: Metric can not be empty")
+	}
+	if err := validateName("metric", p.Metric); err != nil {
+		return err
+	}
+
+	if len(p.Tags) == 0 {
+		return errors.New("PointError: at least one tag is required")
+	}
+	for k, v := range p.Tags {
+		if err := validateName("tag key", k); err != nil {
+			return err
+		}
+		if err := validateName(fmt.Sprintf("value of tag %q", k), v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateName(field string, name string) error {
+	if name == "" {
+		return fmt.Errorf("PointError: %s can not be empty", field)
+	}
+
+	for _, r := range name {
+		if unicode.IsLetter(r) || (r >= '0' && r <= '9') || strings.ContainsRune("-_./", r) {
+			continue
+		}
+		return fmt.Errorf("PointError: %s %q contains invalid character %q", field, name, r)
+	}
+
+	return nil
+}
+
+// AddPoint appends p to the batch, rejecting points that don't pass
+// ValidatePoint
+func (bp *BatchPoints) AddPoint(p *Point) error {
+	if p == nil {
+		return errors.New("PointError: Point can not be nil")
+	}
+	if err := ValidatePoint(*p); err != nil {
+		return err
+	}
+
 	bp.Lock()
 	bp.Points = append(bp.Points, p)
 	bp.Unlock()
+	return nil
 }
 
+// ToJson encodes the batch with tag keys emitted sorted, so the same points
+// always give the same body. AddPoint rejects spaces in tags, but points
+// appended to Points directly are not checked: their tag keys and values are
+// trimmed of surrounding spaces, and keys that then appear twice are merged,
+// or an error when their values conflict. Timestamps that don't match the
+// resolution set by MillisecondTimestamps are an error too.
 func (bp *BatchPoints) ToJson() ([]byte, error) {
-	return json.Marshal(bp.Points)
+	bp.Lock()
+	defer bp.Unlock()
+
+	points := make([]Point, len(bp.Points))
+	for i, p := range bp.Points {
+		if err := validateTimestamp(p.Timestamp, bp.MillisecondTimestamps); err != nil {
+			return nil, fmt.Errorf("%s on metric %q", err, p.Metric)
+		}
+		tags, err := normalizeTags(p.Tags)
+		if err != nil {
+			return nil, fmt.Errorf("%s on metric %q", err, p.Metric)
+		}
+		points[i] = *p
+		points[i].Tags = tags
+	}
+
+	// encoding/json writes map keys in sorted order
+	return json.Marshal(points)
+}
+
+func normalizeTags(tags map[string]string) (map[string]string, error) {
+	normalized := make(map[string]string, len(tags))
+	for k, v := range tags {
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if prev, ok := normalized[k]; ok && prev != v {
+			return nil, fmt.Errorf("PointError: tag %q has conflicting values %q and %q", k, prev, v)
+		}
+		normalized[k] = v
+	}
+	return normalized, nil
+}
+
+// Merge appends the points of other to the batch, other is left unchanged
+func (bp *BatchPoints) Merge(other *BatchPoints) {
+	if other == nil {
+		return
+	}
+
+	other.Lock()
+	points := make([]*Point, len(other.Points))
+	copy(points, other.Points)
+	other.Unlock()
+
+	bp.Lock()
+	bp.Points = append(bp.Points, points...)
+	bp.Unlock()
+}
+
+// Split chunks the batch in order into batches of at most n points, they
+// keep the batch's MillisecondTimestamps. A n of 0 or less gives a single
+// batch with all the points.
+func (bp *BatchPoints) Split(n int) []*BatchPoints {
+	bp.Lock()
+	points := make([]*Point, len(bp.Points))
+	copy(points, bp.Points)
+	ms := bp.MillisecondTimestamps
+	bp.Unlock()
+
+	if n <= 0 {
+		n = len(points)
+	}
+
+	batches := make([]*BatchPoints, 0)
+	for offset := 0; offset < len(points); offset += n {
+		end := offset + n
+		if end > len(points) {
+			end = len(points)
+		}
+		batches = append(batches, &BatchPoints{Points: points[offset:end:end], MillisecondTimestamps: ms})
+	}
+
+	return batches
 }
 
 func (bp *BatchPoints) Size() int {
 	return len(bp.Points)
 }
+
+// Len is the number of points in the batch, same as Size
+func (bp *BatchPoints) Len() int {
+	bp.Lock()
+	defer bp.Unlock()
+	return len(bp.Points)
+}
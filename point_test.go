@@ -35,3 +35,159 @@ func TestNewPoint(t *testing.T) {
 	}
 
 }
+
+func TestAddPoint(t *testing.T) {
+	bp := opentsdb.NewBatchPoints()
+
+	// Expect failure if there are no tags
+	expected := "PointError: at least one tag is required"
+	p := &opentsdb.Point{Metric: "metric", Timestamp: time.Now().Unix(), Value: 1}
+	err := bp.AddPoint(p)
+	if err == nil || err.Error() != expected {
+		t.Error(
+			"Expected", expected,
+			"Got", err,
+		)
+	}
+
+	p.Tags = map[string]string{"host": "a"}
+	if err := bp.AddPoint(p); err != nil || bp.Len() != 1 {
+		t.Error(
+			"Expected", nil, 1,
+			"Got", err, bp.Len(),
+		)
+	}
+}
+
+func TestValidatePoint(t *testing.T) {
+	ts := time.Now().Unix()
+
+	for p, expected := range map[*opentsdb.Point]string{
+		{Metric: "sys cpu", Tags: map[string]string{"host": "a"}}:  `PointError: metric "sys cpu" contains invalid character ' '`,
+		{Metric: "sys.cpu", Tags: map[string]string{"ho:st": "a"}}: `PointError: tag key "ho:st" contains invalid character ':'`,
+		{Metric: "sys.cpu", Tags: map[string]string{"host": ""}}:   `PointError: value of tag "host" can not be empty`,
+	} {
+		p.Timestamp = ts
+		p.Value = 1
+		err := opentsdb.ValidatePoint(*p)
+		if err == nil || err.Error() != expected {
+			t.Error(
+				"Expected", expected,
+				"Got", err,
+			)
+		}
+	}
+
+	p := opentsdb.Point{Metric: "sys.cpu/user-時間_0", Timestamp: ts, Value: 1, Tags: map[string]string{"host": "web01.example"}}
+	if err := opentsdb.ValidatePoint(p); err != nil {
+		t.Error(
+			"Expected", nil,
+			"Got", err,
+		)
+	}
+}
+
+func TestToJsonNormalizesTags(t *testing.T) {
+	bp := opentsdb.NewBatchPoints()
+	bp.Points = append(bp.Points, &opentsdb.Point{
+		Metric:    "metric",
+		Timestamp: 1500000000,
+		Value:     1,
+		Tags:      map[string]string{"zone": "eu", "host ": " a", "host": "a", "dc": "1", "app": "x"},
+	})
+
+	expected := `[{"metric":"metric","timestamp":1500000000,"value":1,` +
+		`"tags":{"app":"x","dc":"1","host":"a","zone":"eu"}}]`
+	for i := 0; i < 20; i++ {
+		data, err := bp.ToJson()
+		if err != nil || string(data) != expected {
+			t.Fatal(
+				"Expected", expected,
+				"Got", string(data), err,
+			)
+		}
+	}
+
+	// Expect failure if tags collide with different values
+	bp.Points[0].Tags = map[string]string{"host": "a", " host": "b"}
+	if _, err := bp.ToJson(); err == nil {
+		t.Error(
+			"Expected", "error",
+			"Got", nil,
+		)
+	}
+}
+
+func TestToJsonTimestamps(t *testing.T) {
+	cases := []struct {
+		ts    int64
+		ms    bool
+		valid bool
+	}{
+		{1500000000, false, true},
+		{1500000000000, false, false},
+		{1500000000000, true, true},
+		{1500000000, true, false},
+		{0, false, false},
+		{-1, true, false},
+	}
+
+	for _, c := range cases {
+		bp := opentsdb.NewBatchPoints()
+		bp.MillisecondTimestamps = c.ms
+		bp.Points = append(bp.Points, &opentsdb.Point{
+			Metric:    "metric",
+			Timestamp: c.ts,
+			Value:     1,
+			Tags:      map[string]string{"host": "a"},
+		})
+
+		_, err := bp.ToJson()
+		if (err == nil) != c.valid {
+			t.Error(
+				"Expected", c.valid, "for", c.ts, "with ms", c.ms,
+				"Got", err,
+			)
+		}
+	}
+}
+
+func TestBatchPointsMergeSplit(t *testing.T) {
+	a := opentsdb.NewBatchPoints()
+	b := opentsdb.NewBatchPoints()
+	for i := 0; i < 3; i++ {
+		a.AddPoint(&opentsdb.Point{Metric: "a", Timestamp: int64(1500000000 + i), Value: i, Tags: map[string]string{"host": "x"}})
+		b.AddPoint(&opentsdb.Point{Metric: "b", Timestamp: int64(1500000000 + i), Value: i, Tags: map[string]string{"host": "x"}})
+	}
+
+	a.Merge(b)
+	if a.Len() != 6 || b.Len() != 3 {
+		t.Fatal(
+			"Expected", 6, 3,
+			"Got", a.Len(), b.Len(),
+		)
+	}
+
+	batches := a.Split(4)
+	if len(batches) != 2 || batches[0].Len() != 4 || batches[1].Len() != 2 {
+		t.Fatal(
+			"Expected", "batches of 4 and 2",
+			"Got", batches,
+		)
+	}
+	if batches[0].Points[3] != a.Points[3] || batches[1].Points[0] != a.Points[4] {
+		t.Error(
+			"Expected", "order preserved",
+			"Got", batches[0].Points, batches[1].Points,
+		)
+	}
+
+	// Expect appends to a chunk to leave the next one alone
+	batches[0].Points = append(batches[0].Points, &opentsdb.Point{Metric: "c"})
+	if batches[1].Points[0].Metric != "b" {
+		t.Error(
+			"Expected", "b",
+			"Got", batches[1].Points[0].Metric,
+		)
+	}
+}
@@ -1,39 +1,456 @@
 package opentsdb
 
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
 type Query struct {
-	Aggregator string            `json:"aggregator"`
-	Metric     string            `json:"metric"`
-	Downsample string            `json:"downsample,omitempty"`
-	Rate       bool              `json:"rate,omitempty"`
-	Tags       map[string]string `json:"tags,omitempty"`
+	Aggregator string `json:"aggregator"`
+
+	// Either a metric, with optional tags and filters, or the TSUIDs of the
+	// series to query
+	Metric string   `json:"metric,omitempty"`
+	TSUIDs []string `json:"tsuids,omitempty"`
+
+	Downsample  string            `json:"downsample,omitempty"`
+	Rate        bool              `json:"rate,omitempty"`
+	RateOptions *RateOptions      `json:"rateOptions,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Filters     []Filter          `json:"filters,omitempty"`
+
+	// Only match series with exactly the tag keys of Tags and Filters,
+	// requires OpenTSDB 2.3
+	ExplicitTags bool `json:"explicitTags,omitempty"`
+
+	// How rollup tables are used, one of the RollupUsage constants,
+	// requires OpenTSDB 2.4
+	// Default: the server's, ROLLUP_FALLBACK
+	RollupUsage string `json:"rollupUsage,omitempty"`
+}
+
+const (
+	// Only read raw data points
+	RollupRaw = "ROLLUP_RAW"
+
+	// Only read the rollup table matching the downsampling
+	RollupNoFallback = "ROLLUP_NOFALLBACK"
+
+	// Read the best matching rollup table, falling back to coarser ones
+	RollupFallback = "ROLLUP_FALLBACK"
+
+	// Read the best matching rollup table, falling back to raw data points
+	RollupFallbackRaw = "ROLLUP_FALLBACK_RAW"
+)
+
+func validateRollupUsage(usage string) error {
+	switch usage {
+	case "", RollupRaw, RollupNoFallback, RollupFallback, RollupFallbackRaw:
+		return nil
+	}
+	return fmt.Errorf("QueryError: rollup usage must be one of %s, %s, %s or %s, got %q",
+		RollupRaw, RollupNoFallback, RollupFallback, RollupFallbackRaw, usage)
+}
+
+// RateOptions tune the rate conversion of monotonic counters, they only apply
+// when Rate is set
+type RateOptions struct {
+	// Treat the metric as a counter that can roll over or reset
+	Counter bool `json:"counter,omitempty"`
+
+	// Value the counter rolls over at
+	// Default: max int64
+	CounterMax int64 `json:"counterMax,omitempty"`
+
+	// Rates above this are considered resets and reported as 0
+	ResetValue int64 `json:"resetValue,omitempty"`
+
+	// Drop the data points of resets instead of reporting 0
+	DropResets bool `json:"dropResets,omitempty"`
 }
 
 type QueryResult struct {
-	Metric        string             `json:"metric"`
-	AggregateTags []string           `json:"aggregateTags,omitempty"`
-	Tags          map[string]string  `json:"tags"`
-	Dps           map[string]float64 `json:"dps"`
+	Metric        string            `json:"metric"`
+	AggregateTags []string          `json:"aggregateTags,omitempty"`
+	Tags          map[string]string `json:"tags"`
+
+	// Data points keyed by timestamp, values are kept as json.Number so no
+	// precision is lost on decoding
+	DPs map[string]json.Number `json:"dps"`
+
+	// Data points whose value isn't a number, e.g. the buckets of
+	// histogram queries, keyed by timestamp
+	RawDPs map[string]json.RawMessage `json:"-"`
+
+	// Data points of a QueryParams.Arrays query, DPs and RawDPs are empty then
+	points []DataPoint
+
+	// The sub-query that produced the series, set with ShowQuery
+	Query *Query `json:"query,omitempty"`
+
+	// Server-side timings of the series, set with ShowStats
+	Stats map[string]interface{} `json:"stats,omitempty"`
+
+	// TSUIDs of the series aggregated in the result, set with ShowTSUIDs
+	TSUIDs []string `json:"tsuids,omitempty"`
+
+	// Global annotations in the query time range, set with GlobalAnnotations
+	GlobalAnnotations []Annotation `json:"globalAnnotations,omitempty"`
+
+	// Timings of the whole query, only set on the last element of the
+	// results when ShowSummary or ShowStats is set
+	StatsSummary map[string]interface{} `json:"statsSummary,omitempty"`
+}
+
+type DataPoint struct {
+	// Timestamp as returned by the server, seconds or milliseconds
+	Timestamp int64
+
+	// Timestamp in milliseconds whatever the server returned
+	TimestampMs int64
+	Value       float64
+
+	// Value exactly as sent by the server, Value loses precision above 2^53
+	Number json.Number
+
+	// Set instead of Value and Number when the value isn't a number, e.g.
+	// histogram buckets
+	RawValue json.RawMessage
+}
+
+// Time returns the timestamp of the data point as a time.Time
+func (d DataPoint) Time() time.Time {
+	return time.Unix(0, d.TimestampMs*int64(time.Millisecond))
+}
+
+func (d DataPoint) Float64() (float64, error) {
+	return d.Number.Float64()
+}
+
+// Int64 returns the exact integer value, an error if the value isn't an
+// integer
+func (d DataPoint) Int64() (int64, error) {
+	return d.Number.Int64()
+}
+
+// UnmarshalJSON decodes the result, moving the data points that aren't
+// numbers to RawDPs instead of failing. Data points sent as arrays are kept
+// for DataPoints.
+func (r *QueryResult) UnmarshalJSON(data []byte) error {
+	type plain QueryResult
+	aux := struct {
+		*plain
+		DPs json.RawMessage `json:"dps"`
+	}{plain: (*plain)(r)}
+
+	if err := decodeNumbers(data, &aux); err != nil {
+		return err
+	}
+
+	r.DPs, r.RawDPs, r.points = nil, nil, nil
+	dps := bytes.TrimSpace(aux.DPs)
+	if len(dps) > 0 && dps[0] == '[' {
+		return r.decodeArrays(dps)
+	}
+
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(dps, &values); err != nil && len(dps) > 0 {
+		return err
+	}
+	if values != nil {
+		r.DPs = make(map[string]json.Number, len(values))
+	}
+	for k, v := range values {
+		if n, ok := scalar(v); ok {
+			r.DPs[k] = n
+			continue
+		}
+		if r.RawDPs == nil {
+			r.RawDPs = make(map[string]json.RawMessage)
+		}
+		r.RawDPs[k] = bytes.TrimSpace(v)
+	}
+
+	return nil
+}
+
+// decodeArrays decodes data points sent as [timestamp, value] arrays
+func (r *QueryResult) decodeArrays(dps []byte) error {
+	var pairs [][]json.RawMessage
+	if err := json.Unmarshal(dps, &pairs); err != nil {
+		return err
+	}
+
+	r.points = make([]DataPoint, 0, len(pairs))
+	for _, pair := range pairs {
+		if len(pair) != 2 {
+			return fmt.Errorf("QueryError: data point %s is not a [timestamp, value] pair", pair)
+		}
+		ts, err := strconv.ParseInt(string(bytes.TrimSpace(pair[0])), 10, 64)
+		if err != nil {
+			return err
+		}
+
+		p := DataPoint{Timestamp: ts, TimestampMs: toMilliseconds(ts)}
+		if n, ok := scalar(pair[1]); ok {
+			if p.Value, err = n.Float64(); err != nil {
+				return err
+			}
+			p.Number = n
+		} else {
+			p.RawValue = bytes.TrimSpace(pair[1])
+		}
+		r.points = append(r.points, p)
+	}
+
+	return nil
+}
+
+// scalar returns v as a number when it is one
+func scalar(v json.RawMessage) (json.Number, bool) {
+	v = bytes.TrimSpace(v)
+	if len(v) > 0 && (v[0] == '-' || (v[0] >= '0' && v[0] <= '9')) {
+		return json.Number(v), true
+	}
+	return "", false
+}
+
+// DataPoints returns the data points of the result sorted by ascending
+// timestamp. Second and millisecond keys, e.g. with MsResolution, are
+// compared on the same scale.
+// Values from RawDPs only have RawValue set.
+func (r *QueryResult) DataPoints() ([]DataPoint, error) {
+	if r.points != nil {
+		points := make([]DataPoint, len(r.points))
+		copy(points, r.points)
+		sortDataPoints(points)
+		return points, nil
+	}
+
+	points := make([]DataPoint, 0, len(r.DPs)+len(r.RawDPs))
+	for k, v := range r.DPs {
+		ts, err := strconv.ParseInt(k, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		value, err := v.Float64()
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, DataPoint{Timestamp: ts, TimestampMs: toMilliseconds(ts), Value: value, Number: v})
+	}
+	for k, v := range r.RawDPs {
+		ts, err := strconv.ParseInt(k, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, DataPoint{Timestamp: ts, TimestampMs: toMilliseconds(ts), RawValue: v})
+	}
+
+	sortDataPoints(points)
+	return points, nil
+}
+
+// pointCount returns the number of data points in the result, whichever
+// form they were decoded into
+func (r *QueryResult) pointCount() int {
+	if r.points != nil {
+		return len(r.points)
+	}
+	return len(r.DPs) + len(r.RawDPs)
+}
+
+func sortDataPoints(points []DataPoint) {
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i].TimestampMs < points[j].TimestampMs
+	})
+}
+
+// SeriesKey identifies a series by its metric and tags, sorted by key, e.g.
+// "sys.cpu.user{dc=eu,host=web01}". It's the key of the QueryMap results.
+func SeriesKey(metric string, tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + tags[k]
+	}
+	return metric + "{" + strings.Join(pairs, ",") + "}"
+}
+
+// toMilliseconds reads ts the way OpenTSDB does, see maxSecondTimestamp
+func toMilliseconds(ts int64) int64 {
+	if ts > maxSecondTimestamp {
+		return ts
+	}
+	return ts * 1000
+}
+
+// decodeNumbers unmarshals a query response keeping numbers as json.Number,
+// also for values decoded into interface{}
+func decodeNumbers(body []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	return dec.Decode(v)
 }
 
 type QueryParams struct {
 	Start             interface{} `json:"start"`
 	End               interface{} `json:"end,omitempty"`
 	Queries           []Query     `json:"queries,omitempty"`
-	NoAnnotations     bool        `json:"no_annotations,omitempty"`
-	GlobalAnnotations bool        `json:"global_annotations,omitempty"`
-	MsResolution      bool        `json:"ms,omitempty"`
-	ShowTSUIDs        bool        `json:"show_tsuids,omitempty"`
-	ShowSummary       bool        `json:"show_summary,omitempty"`
-	ShowQuery         bool        `json:"show_query,omitempty"`
+	NoAnnotations     bool        `json:"noAnnotations,omitempty"`
+	GlobalAnnotations bool        `json:"globalAnnotations,omitempty"`
+	MsResolution      bool        `json:"msResolution,omitempty"`
+	ShowTSUIDs        bool        `json:"showTSUIDs,omitempty"`
+	ShowSummary       bool        `json:"showSummary,omitempty"`
+	ShowStats         bool        `json:"showStats,omitempty"`
+	ShowQuery         bool        `json:"showQuery,omitempty"`
 	Delete            bool        `json:"delete,omitempty"`
+
+	// Get the data points of the results as [timestamp, value] arrays,
+	// cheaper to decode than the map, requires OpenTSDB 2.3. The points are
+	// then only available with QueryResult.DataPoints.
+	Arrays bool `json:"-"`
+}
+
+// rawQuery returns the URL query of the flags OpenTSDB reads from the URL
+// instead of the body
+func (q *QueryParams) rawQuery() string {
+	if q.Arrays {
+		return "arrays=true"
+	}
+	return ""
+}
+
+func (q *QueryParams) validate() error {
+	if q == nil {
+		return errors.New("QueryError: query can not be nil")
+	}
+	for i, sub := range q.Queries {
+		if (sub.Metric == "") == (len(sub.TSUIDs) == 0) {
+			return fmt.Errorf("QueryError: sub-query %d must have either a metric or TSUIDs", i)
+		}
+		if err := validateRollupUsage(sub.RollupUsage); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func NewQueryParams() (*QueryParams, error) {
 	return &QueryParams{}, nil
 }
 
+// DeleteOptions guard QueryDelete against accidental deletes
+type DeleteOptions struct {
+	// Required
+	// Must be true for the delete to be sent
+	Confirm bool
+}
+
+// DeleteResult is what QueryDelete removed
+type DeleteResult struct {
+	// Matched series with the data points that were deleted
+	Series []QueryResult
+
+	// Total number of deleted data points
+	DeletedPoints int
+}
+
+type LastQuery struct {
+	// Either a metric with optional tags or a list of TSUIDs
+	Metric string            `json:"metric,omitempty"`
+	Tags   map[string]string `json:"tags,omitempty"`
+	TSUIDs []string          `json:"tsuids,omitempty"`
+}
+
+type LastQueryParams struct {
+	Queries []LastQuery `json:"queries"`
+
+	// Resolve the metric and tag names of the returned points, needed to
+	// get names back when querying by TSUID
+	ResolveNames bool `json:"resolveNames,omitempty"`
+
+	// Number of hours to look back for a value when the meta data table
+	// isn't used. Bound it on sparse series, the scan can take very long
+	// otherwise.
+	// Default: the server's, 0 only checks the meta data table
+	BackScan int `json:"backScan,omitempty"`
+}
+
+type LastDataPoint struct {
+	Metric    string            `json:"metric,omitempty"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	TSUID     string            `json:"tsuid"`
+	Timestamp int64             `json:"timestamp"`
+	Value     json.Number       `json:"value"`
+}
+
+type FilterInfo struct {
+	Description string `json:"description"`
+	Examples    string `json:"examples"`
+
+	// Not reported by every OpenTSDB version, false when absent
+	UsesRegex       bool `json:"usesRegex,omitempty"`
+	AllowsMultiples bool `json:"allowsMultiples,omitempty"`
+}
+
+const (
+	SuggestTypeMetrics = "metrics"
+	SuggestTypeTagK    = "tagk"
+	SuggestTypeTagV    = "tagv"
+)
+
+// Number of suggestions returned when SuggestParams.Max is 0
+const defaultSuggestMax = 25
+
+type SuggestResult struct {
+	Values []string
+
+	// The server returned as many values as allowed, there may be more
+	Truncated bool
+}
+
+// SuggestParams are the arguments of api/suggest, which takes no others
 type SuggestParams struct {
-	Type  string `json:"type"`
-	Match string `json:"q,omnitempty"`
-	Max   int    `json:"max,omitempty"`
-}
\ No newline at end of file
+	// Required
+	// One of SuggestTypeMetrics, SuggestTypeTagK or SuggestTypeTagV
+	Type string `json:"type"`
+
+	// Prefix the values start with, empty matches them all
+	Match string `json:"q,omitempty"`
+
+	// Maximum number of values returned
+	// Default: the server's, 25
+	Max int `json:"max,omitempty"`
+}
+
+func SuggestMetrics(prefix string, max int) *SuggestParams {
+	return &SuggestParams{Type: SuggestTypeMetrics, Match: prefix, Max: max}
+}
+
+func SuggestTagK(prefix string, max int) *SuggestParams {
+	return &SuggestParams{Type: SuggestTypeTagK, Match: prefix, Max: max}
+}
+
+func SuggestTagV(prefix string, max int) *SuggestParams {
+	return &SuggestParams{Type: SuggestTypeTagV, Match: prefix, Max: max}
+}
+
+func (s *SuggestParams) validate() error {
+	switch s.Type {
+	case SuggestTypeMetrics, SuggestTypeTagK, SuggestTypeTagV:
+		return nil
+	}
+	return fmt.Errorf("SuggestError: type must be one of metrics, tagk or tagv, got %q", s.Type)
+}
@@ -0,0 +1,301 @@
+package opentsdb_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/whitesmith/go-opentsdb"
+)
+
+func TestQueryBuilder(t *testing.T) {
+	q, err := opentsdb.NewQuery().Start("1h-ago").End(int64(1500000000)).
+		AddMetric("sum", "sys.cpu.user").WithTags(map[string]string{"host": "*"}).
+		AddMetric("avg", "sys.if.bytes").WithDownsample("1m-avg").WithRate().
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := json.Marshal(q)
+	expected := `{"start":"1h-ago","end":1500000000,"queries":[` +
+		`{"aggregator":"sum","metric":"sys.cpu.user","tags":{"host":"*"}},` +
+		`{"aggregator":"avg","metric":"sys.if.bytes","downsample":"1m-avg","rate":true}]}`
+	if string(data) != expected {
+		t.Error(
+			"Expected", expected,
+			"Got", string(data),
+		)
+	}
+
+	// Expect failure if sub-query options come before any metric
+	_, err = opentsdb.NewQuery().Start("1h-ago").WithRate().AddMetric("sum", "m").Build()
+	if err == nil {
+		t.Error(
+			"Expected", "error",
+			"Got", nil,
+		)
+	}
+}
+
+func TestFilters(t *testing.T) {
+	f := opentsdb.LiteralOr("host", []string{"web01", "web02"}, true)
+	data, _ := json.Marshal(f)
+	expected := `{"type":"literal_or","tagk":"host","filter":"web01|web02","groupBy":true}`
+	if string(data) != expected {
+		t.Error(
+			"Expected", expected,
+			"Got", string(data),
+		)
+	}
+
+	// Expect failure if the regexp doesn't compile
+	if _, err := opentsdb.Regexp("host", "web(", false); err == nil {
+		t.Error(
+			"Expected", "error",
+			"Got", nil,
+		)
+	}
+}
+
+func TestQueryBuilderDownsample(t *testing.T) {
+	q, err := opentsdb.NewQuery().Start("1h-ago").AddMetric("sum", "m").Downsample("1m", "avg", "zero").Build()
+	if err != nil || q.Queries[0].Downsample != "1m-avg-zero" {
+		t.Error(
+			"Expected", "1m-avg-zero",
+			"Got", q, err,
+		)
+	}
+
+	// Expect failure if the fill policy is unknown
+	_, err = opentsdb.NewQuery().Start("1h-ago").AddMetric("sum", "m").Downsample("1m", "avg", "zeros").Build()
+	if err == nil {
+		t.Error(
+			"Expected", "error",
+			"Got", nil,
+		)
+	}
+}
+
+func TestDataPointsPrecision(t *testing.T) {
+	var results []opentsdb.QueryResult
+	body := `[{"metric":"if.bytes","tags":{},"dps":{"1500000060":9007199254740993,"1500000000":1.5}}]`
+	if err := json.Unmarshal([]byte(body), &results); err != nil {
+		t.Fatal(err)
+	}
+
+	points, err := results[0].DataPoints()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if points[0].Timestamp != 1500000000 || points[1].Timestamp != 1500000060 {
+		t.Error(
+			"Expected", "points sorted by timestamp",
+			"Got", points,
+		)
+	}
+
+	v, err := points[1].Int64()
+	if err != nil || v != 9007199254740993 {
+		t.Error(
+			"Expected", int64(9007199254740993),
+			"Got", v, err,
+		)
+	}
+}
+
+func TestQueryExplicitTags(t *testing.T) {
+	q := opentsdb.Query{Aggregator: "sum", Metric: "sys.cpu.user", Tags: map[string]string{"host": "a"}}
+
+	data, _ := json.Marshal(q)
+	if strings.Contains(string(data), "explicitTags") {
+		t.Error(
+			"Expected", "no explicitTags",
+			"Got", string(data),
+		)
+	}
+
+	q.ExplicitTags = true
+	data, _ = json.Marshal(q)
+	if !strings.Contains(string(data), `"explicitTags":true`) {
+		t.Error(
+			"Expected", `"explicitTags":true`,
+			"Got", string(data),
+		)
+	}
+}
+
+func TestQueryResultRawValues(t *testing.T) {
+	var results []opentsdb.QueryResult
+	body := `[{"metric":"latency","tags":{},"dps":{"1500000000":{"0,10":3,"10,20":1},"1500000060":2.5}},` +
+		`{"metric":"cpu","tags":{},"dps":{"1500000000":1}}]`
+	if err := json.Unmarshal([]byte(body), &results); err != nil || len(results) != 2 {
+		t.Fatal(
+			"Expected", "2 results",
+			"Got", results, err,
+		)
+	}
+
+	points, err := results[0].DataPoints()
+	if err != nil || len(points) != 2 {
+		t.Fatal(
+			"Expected", "2 points",
+			"Got", points, err,
+		)
+	}
+
+	if string(points[0].RawValue) != `{"0,10":3,"10,20":1}` || points[1].Value != 2.5 || points[1].RawValue != nil {
+		t.Error(
+			"Expected", "raw bucket value then 2.5",
+			"Got", points,
+		)
+	}
+}
+
+func TestQueryRollupUsage(t *testing.T) {
+	q, err := opentsdb.NewQuery().Start("30d-ago").
+		AddMetric("sum", "sys.cpu.user").WithDownsample("1h-sum").WithRollupUsage(opentsdb.RollupFallbackRaw).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := json.Marshal(q)
+	if !strings.Contains(string(data), `"rollupUsage":"ROLLUP_FALLBACK_RAW"`) {
+		t.Error(
+			"Expected", `"rollupUsage":"ROLLUP_FALLBACK_RAW"`,
+			"Got", string(data),
+		)
+	}
+
+	// Expect failure on an unknown usage
+	_, err = opentsdb.NewQuery().Start("30d-ago").
+		AddMetric("sum", "sys.cpu.user").WithRollupUsage("rollup_fallback").
+		Build()
+	if err == nil {
+		t.Error(
+			"Expected", "error",
+			"Got", nil,
+		)
+	}
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: "http://127.0.0.1:1"})
+	q.Queries[0].RollupUsage = "ROLLUP_SOMETIMES"
+	if _, err := client.Query(q); err == nil || !strings.HasPrefix(err.Error(), "QueryError") {
+		t.Error(
+			"Expected", "QueryError",
+			"Got", err,
+		)
+	}
+}
+
+func TestQueryTSUIDs(t *testing.T) {
+	q, err := opentsdb.NewQuery().Start("1h-ago").
+		AddTSUIDs("sum", "000001000001000001", "000001000001000002").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := json.Marshal(q.Queries[0])
+	expected := `{"aggregator":"sum","tsuids":["000001000001000001","000001000001000002"]}`
+	if string(data) != expected {
+		t.Error(
+			"Expected", expected,
+			"Got", string(data),
+		)
+	}
+
+	// Expect failure with both a metric and TSUIDs, or neither
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: "http://127.0.0.1:1"})
+	for _, sub := range []opentsdb.Query{
+		{Aggregator: "sum", Metric: "sys.cpu.user", TSUIDs: []string{"000001000001000001"}},
+		{Aggregator: "sum"},
+	} {
+		q.Queries = []opentsdb.Query{sub}
+		if _, err := client.Query(q); err == nil || !strings.HasPrefix(err.Error(), "QueryError") {
+			t.Error(
+				"Expected", "QueryError",
+				"Got", err,
+			)
+		}
+	}
+}
+
+func TestTimeHelpers(t *testing.T) {
+	relative := map[time.Duration]string{
+		2 * time.Hour:           "2h-ago",
+		90 * time.Minute:        "90m-ago",
+		14 * 24 * time.Hour:     "2w-ago",
+		1500 * time.Millisecond: "1500ms-ago",
+		0:                       "now",
+	}
+	for d, expected := range relative {
+		if got := opentsdb.RelativeTime(d); got != expected {
+			t.Error(
+				"Expected", expected,
+				"Got", got,
+			)
+		}
+	}
+
+	if got := opentsdb.FormatTime(time.Unix(1500000000, 0)); got != "1500000000" {
+		t.Error(
+			"Expected", "1500000000",
+			"Got", got,
+		)
+	}
+	if got := opentsdb.FormatTime(time.Unix(1500000000, 250*int64(time.Millisecond))); got != "1500000000250" {
+		t.Error(
+			"Expected", "1500000000250",
+			"Got", got,
+		)
+	}
+
+	q, _ := opentsdb.NewQueryParams()
+	q.SetStartAgo(2 * time.Hour)
+	q.SetEnd(time.Unix(1500000000, 0))
+	if q.Start != "2h-ago" || q.End != "1500000000" {
+		t.Error(
+			"Expected", "2h-ago", "1500000000",
+			"Got", q.Start, q.End,
+		)
+	}
+}
+
+func TestDataPointsMsResolution(t *testing.T) {
+	data, _ := json.Marshal(&opentsdb.QueryParams{Start: "1h-ago", MsResolution: true})
+	if !strings.Contains(string(data), `"msResolution":true`) {
+		t.Error(
+			"Expected", `"msResolution":true`,
+			"Got", string(data),
+		)
+	}
+
+	var results []opentsdb.QueryResult
+	// Past 32 bits a timestamp is in milliseconds, as on write
+	body := `[{"metric":"m","tags":{},"dps":{"1500000000500":2,"1500000000":1,"1500000001000":3,"4294967296":0}}]`
+	if err := json.Unmarshal([]byte(body), &results); err != nil {
+		t.Fatal(err)
+	}
+
+	points, err := results[0].DataPoints()
+	if err != nil || len(points) != 4 {
+		t.Fatal(
+			"Expected", "4 points",
+			"Got", points, err,
+		)
+	}
+
+	expected := []int64{4294967296, 1500000000000, 1500000000500, 1500000001000}
+	for i, p := range points {
+		if p.TimestampMs != expected[i] || !p.Time().Equal(time.Unix(0, expected[i]*int64(time.Millisecond))) {
+			t.Error(
+				"Expected", expected[i],
+				"Got", p.TimestampMs, p.Time(),
+			)
+		}
+	}
+}
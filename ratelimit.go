@@ -0,0 +1,70 @@
+package opentsdb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// rateLimiter lets through rate calls per second on average and up to burst
+// calls at once. It tracks the time the next call is due, every call pushes
+// it back by one interval.
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	burst    int
+	due      time.Time
+}
+
+// rateLimitedKey marks the context of the requests that wait for
+// Client.limiter, once per attempt
+type rateLimitedKey struct{}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		interval: time.Duration(float64(time.Second) / rate),
+		burst:    burst,
+	}
+}
+
+// wait blocks until the caller may go or ctx is done. It fails right away
+// when the turn of the caller comes after the deadline of ctx.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	due := l.due
+	if due.Before(now) {
+		due = now
+	}
+
+	// The calls of a burst are due before the current due time
+	delay := due.Add(-time.Duration(l.burst-1) * l.interval).Sub(now)
+	if deadline, ok := ctx.Deadline(); ok && delay > 0 && now.Add(delay).After(deadline) {
+		l.mu.Unlock()
+		return fmt.Errorf("PutError: rate limit wait of %s exceeds the context deadline: %w", delay, context.DeadlineExceeded)
+	}
+	l.due = due.Add(l.interval)
+	reserved := l.due
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// Give the turn back unless later callers reserved theirs after it,
+		// they would end up sharing a turn
+		l.mu.Lock()
+		if l.due.Equal(reserved) {
+			l.due = reserved.Add(-l.interval)
+		}
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
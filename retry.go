@@ -0,0 +1,60 @@
+package opentsdb
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy controls how failed requests are retried. Requests are retried
+// on network errors and 5xx responses only, never on 4xx.
+type RetryPolicy struct {
+	// Number of retries after the first attempt
+	// Default: 0, requests are not retried
+	MaxRetries int
+
+	// Delay before the first retry, doubled on every following one
+	// Default: 100ms
+	BaseDelay time.Duration
+
+	// Upper bound of the delay between two attempts
+	// Default: 10s
+	MaxDelay time.Duration
+}
+
+// backoff returns the delay before retry number attempt (starting at 0): an
+// exponential delay with jitter, picked at random in its upper half
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	base, max := p.BaseDelay, p.MaxDelay
+	if base <= 0 {
+		base = 100 * time.Millisecond
+	}
+	if max <= 0 {
+		max = 10 * time.Second
+	}
+
+	// Doubling only while below max/2 can't overflow, unlike a shift
+	delay := base
+	for i := 0; i < attempt && delay <= max/2; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// retryable reports whether the outcome of an attempt is worth retrying
+func retryable(resp *http.Response, err error) bool {
+	if errors.Is(err, ErrResponseTooLarge) {
+		// The server would send the same response again
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode >= 500
+}
@@ -0,0 +1,90 @@
+package opentsdb
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+)
+
+type SearchQuery struct {
+	// Metric to look up, empty or "*" matches every metric
+	Metric string
+
+	// Map of tags, "*" may be used as a wildcard key or value
+	// example: {"host": "*"}
+	Tags map[string]string
+
+	// Maximum number of results, 0 uses the server default
+	Limit int
+
+	// Look up through the meta table instead of the data table
+	UseMeta bool
+}
+
+type searchTag struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// MarshalJSON encodes the tags as the list of key/value pairs the lookup
+// endpoint expects, sorted by key so the body is deterministic.
+func (q *SearchQuery) MarshalJSON() ([]byte, error) {
+	keys := make([]string, 0, len(q.Tags))
+	for k := range q.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	tags := make([]searchTag, 0, len(keys))
+	for _, k := range keys {
+		tags = append(tags, searchTag{Key: k, Value: q.Tags[k]})
+	}
+
+	return json.Marshal(struct {
+		Metric  string      `json:"metric,omitempty"`
+		Tags    []searchTag `json:"tags,omitempty"`
+		Limit   int         `json:"limit,omitempty"`
+		UseMeta bool        `json:"useMeta,omitempty"`
+	}{q.Metric, tags, q.Limit, q.UseMeta})
+}
+
+type TimeSeriesLookup struct {
+	Metric string            `json:"metric"`
+	Tags   map[string]string `json:"tags"`
+	TSUID  string            `json:"tsuid"`
+}
+
+type SearchResult struct {
+	Type         string             `json:"type"`
+	Metric       string             `json:"metric"`
+	Limit        int                `json:"limit"`
+	StartIndex   int                `json:"startIndex"`
+	Time         float64            `json:"time"`
+	TotalResults int                `json:"totalResults"`
+	Results      []TimeSeriesLookup `json:"results"`
+}
+
+func (c *Client) SearchLookup(q *SearchQuery) (*SearchResult, error) {
+	return c.SearchLookupContext(context.Background(), q)
+}
+
+func (c *Client) SearchLookupContext(ctx context.Context, q *SearchQuery) (*SearchResult, error) {
+
+	data, err := json.Marshal(q)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := c.ExecRequestContext(ctx, "POST", "api/search/lookup", data)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SearchResult{}
+	if err := json.Unmarshal(body, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+
+}
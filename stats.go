@@ -0,0 +1,255 @@
+package opentsdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+type Stat struct {
+	// Internal TSD metric e.g.: "tsd.rpc.received"
+	Metric string `json:"metric"`
+
+	// Timestamp unix time the stat was collected at
+	Timestamp int64 `json:"timestamp"`
+
+	// Value is kept as json.Number so large counters don't lose precision
+	Value json.Number `json:"value"`
+
+	Tags map[string]string `json:"tags"`
+}
+
+func (c *Client) Stats() ([]Stat, error) {
+	return c.StatsContext(context.Background())
+}
+
+func (c *Client) StatsContext(ctx context.Context) ([]Stat, error) {
+
+	body, err := c.ExecRequestContext(ctx, "GET", "api/stats", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make([]Stat, 0)
+	if err := json.Unmarshal(body, &stats); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+
+}
+
+type JVMStats struct {
+	OS      JVMOSStats              `json:"os"`
+	GC      map[string]JVMGCStats   `json:"gc"`
+	Runtime JVMRuntimeStats         `json:"runtime"`
+	Pools   map[string]JVMPoolStats `json:"pools,omitempty"`
+	Memory  JVMMemoryStats          `json:"memory"`
+}
+
+type JVMOSStats struct {
+	SystemLoadAverage float64 `json:"systemLoadAverage"`
+}
+
+type JVMGCStats struct {
+	CollectionTime  int64 `json:"collectionTime"`
+	CollectionCount int64 `json:"collectionCount"`
+}
+
+type JVMRuntimeStats struct {
+	StartTime int64  `json:"startTime"`
+	Uptime    int64  `json:"uptime"`
+	VMVersion string `json:"vmVersion"`
+	VMVendor  string `json:"vmVendor"`
+	VMName    string `json:"vmName"`
+}
+
+type JVMMemoryUsage struct {
+	Init      int64 `json:"init"`
+	Used      int64 `json:"used"`
+	Committed int64 `json:"committed"`
+	Max       int64 `json:"max"`
+}
+
+type JVMPoolStats struct {
+	Name            string         `json:"name"`
+	Type            string         `json:"type"`
+	Usage           JVMMemoryUsage `json:"usage"`
+	PeakUsage       JVMMemoryUsage `json:"peakUsage"`
+	CollectionUsage JVMMemoryUsage `json:"collectionUsage"`
+}
+
+type JVMMemoryStats struct {
+	ObjectsPendingFinalization int64          `json:"objectsPendingFinalization"`
+	HeapMemoryUsage            JVMMemoryUsage `json:"heapMemoryUsage"`
+	NonHeapMemoryUsage         JVMMemoryUsage `json:"nonHeapMemoryUsage"`
+}
+
+func (c *Client) JVMStats() (*JVMStats, error) {
+	return c.JVMStatsContext(context.Background())
+}
+
+func (c *Client) JVMStatsContext(ctx context.Context) (*JVMStats, error) {
+
+	body, err := c.ExecRequestContext(ctx, "GET", "api/stats/jvm", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &JVMStats{}
+	if err := json.Unmarshal(body, stats); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+
+}
+
+type ThreadInfo struct {
+	ThreadID    int64    `json:"threadID"`
+	Name        string   `json:"name"`
+	State       string   `json:"state"`
+	Priority    int      `json:"priority"`
+	Interrupted bool     `json:"interrupted"`
+	StackTrace  []string `json:"stack"`
+}
+
+// ThreadStats returns a thread dump of the TSD. If the endpoint is disabled or
+// unsupported by the server the returned error wraps ErrNotFound.
+func (c *Client) ThreadStats() ([]ThreadInfo, error) {
+	return c.ThreadStatsContext(context.Background())
+}
+
+func (c *Client) ThreadStatsContext(ctx context.Context) ([]ThreadInfo, error) {
+
+	body, err := c.ExecRequestContext(ctx, "GET", "api/stats/threads", nil)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, fmt.Errorf("StatsError: thread stats unavailable: %w", err)
+		}
+		return nil, err
+	}
+
+	threads := make([]ThreadInfo, 0)
+	if err := json.Unmarshal(body, &threads); err != nil {
+		return nil, err
+	}
+
+	return threads, nil
+
+}
+
+type RegionClientStat struct {
+	// HBase region server address e.g.: "10.0.0.1:60020"
+	Server             string `json:"endpoint"`
+	RpcsSent           int64  `json:"rpcsSent"`
+	RpcsInFlight       int64  `json:"rpcsInFlight"`
+	RpcsTimedOut       int64  `json:"rpcsTimedout"`
+	PendingRPCs        int64  `json:"pendingRPCs"`
+	PendingBatchedRPCs int64  `json:"pendingBatchedRPCs"`
+	WritesBlocked      int64  `json:"writesBlocked"`
+	InflightBreached   int64  `json:"inflightBreached"`
+	PendingBreached    int64  `json:"pendingBreached"`
+
+	// True when the client considers the region server dead
+	DeadRegions bool `json:"dead"`
+}
+
+func (c *Client) RegionClientStats() ([]RegionClientStat, error) {
+	return c.RegionClientStatsContext(context.Background())
+}
+
+func (c *Client) RegionClientStatsContext(ctx context.Context) ([]RegionClientStat, error) {
+
+	body, err := c.ExecRequestContext(ctx, "GET", "api/stats/region_clients", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make([]RegionClientStat, 0)
+	if err := json.Unmarshal(body, &stats); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+
+}
+
+// QueryStat describes a query run by the TSD. The fields vary across
+// OpenTSDB versions, the ones not modeled here are found in Raw.
+type QueryStat struct {
+	Query *QueryParams `json:"query"`
+
+	// User and address the query came from
+	User    string            `json:"user"`
+	Remote  string            `json:"remote"`
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Unix times in milliseconds, completed is 0 while the query runs
+	QueryStartTimestamp     int64 `json:"queryStartTimestamp"`
+	QueryCompletedTimestamp int64 `json:"queryCompletedTimestamp"`
+
+	// Number of times the same query was executed
+	Executed int64 `json:"executed"`
+
+	// Error the query failed with, if any
+	Exception string `json:"exception,omitempty"`
+
+	HTTPResponse struct {
+		Code         int    `json:"code"`
+		ReasonPhrase string `json:"reasonPhrase"`
+	} `json:"httpResponse"`
+
+	// Timings and counters of the query, e.g. "rowsPreFilter" or
+	// "successfulScan"
+	Stats map[string]interface{} `json:"stats,omitempty"`
+
+	// Every field of the stat as sent by the server
+	Raw map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON decodes the modeled fields and keeps all of them in Raw
+func (s *QueryStat) UnmarshalJSON(data []byte) error {
+	type plain QueryStat
+	if err := decodeNumbers(data, (*plain)(s)); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &s.Raw)
+}
+
+type QueryStatsResult struct {
+	Running   []QueryStat `json:"running"`
+	Completed []QueryStat `json:"completed"`
+
+	// Aggregated stats of the completed queries, not sent by every version
+	Summary map[string]interface{} `json:"summary,omitempty"`
+
+	// Every section of the response as sent by the server
+	Raw map[string]json.RawMessage `json:"-"`
+}
+
+// QueryStats returns the queries running on the TSD and the recently
+// completed ones, as reported by api/stats/query
+func (c *Client) QueryStats() (*QueryStatsResult, error) {
+	return c.QueryStatsContext(context.Background())
+}
+
+func (c *Client) QueryStatsContext(ctx context.Context) (*QueryStatsResult, error) {
+
+	body, err := c.ExecRequestContext(ctx, "GET", "api/stats/query", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &QueryStatsResult{}
+	if err := decodeNumbers(body, stats); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(body, &stats.Raw); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+
+}
@@ -0,0 +1,174 @@
+package opentsdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// QueryResultIterator decodes the series of a query response one at a time,
+// without holding the whole response in memory. It must be drained or
+// closed to release the connection.
+type QueryResultIterator struct {
+	release func()
+	resp    *http.Response
+	body    io.ReadCloser
+	dec     *json.Decoder
+	err     error
+}
+
+// QueryStream sends q and returns an iterator over the series of the
+// response. Unlike the other calls the request is sent once, without
+// retries.
+func (c *Client) QueryStream(q *QueryParams) (*QueryResultIterator, error) {
+	return c.QueryStreamContext(context.Background(), q)
+}
+
+func (c *Client) QueryStreamContext(ctx context.Context, q *QueryParams) (*QueryResultIterator, error) {
+
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(q)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, release, err := c.open(ctx, "POST", "api/query", q.rawQuery(), data)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := responseBody(resp)
+	if err != nil {
+		resp.Body.Close()
+		release()
+		return nil, err
+	}
+
+	if resp.StatusCode >= 400 {
+		defer release()
+		defer resp.Body.Close()
+		defer body.Close()
+
+		b, err := ioutil.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		return nil, responseError(resp, b)
+	}
+
+	it := &QueryResultIterator{release: release, resp: resp, body: body, dec: json.NewDecoder(body)}
+	it.dec.UseNumber()
+
+	tok, err := it.dec.Token()
+	if err != nil {
+		it.Close()
+		return nil, err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		it.Close()
+		return nil, errors.New("QueryError: response is not an array of results")
+	}
+
+	return it, nil
+
+}
+
+// open sends a single request to the next endpoint and returns the response
+// with its body unread. release must be called once the body is closed.
+func (c *Client) open(ctx context.Context, requestType string, requestPath string, rawQuery string, requestParams []byte) (*http.Response, func(), error) {
+
+	ctx, release, err := c.bind(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req, err := c.newRequest(ctx, requestType, requestPath, rawQuery, requestParams)
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+	if c.dryRun {
+		release()
+		return nil, nil, c.prepare(req)
+	}
+
+	done := c.observe(req)
+
+	e := c.endpoints.pick()
+	req.URL = e.requestURL(req.URL.Path, req.URL.RawQuery)
+	req.Host = req.URL.Host
+
+	if c.intercept != nil {
+		if err := c.intercept(req); err != nil {
+			release()
+			done(nil, err)
+			return nil, nil, err
+		}
+	}
+
+	resp, err := c.httpClient.Do(req)
+	c.endpoints.report(e, retryable(resp, err) && ctx.Err() == nil)
+	if err != nil {
+		release()
+		if c.ctx.Err() != nil {
+			err = ErrClientClosed
+		}
+		done(nil, err)
+		return nil, nil, err
+	}
+	done(resp, nil)
+
+	return resp, release, nil
+
+}
+
+// Next returns the next series of the response, or io.EOF once all were
+// read. The response is closed when it returns an error, io.EOF included.
+func (it *QueryResultIterator) Next() (*QueryResult, error) {
+	if it.err != nil {
+		return nil, it.err
+	}
+
+	if !it.dec.More() {
+		// Consume the closing bracket so a truncated response is an error
+		if _, err := it.dec.Token(); err != nil {
+			return nil, it.fail(err)
+		}
+		return nil, it.fail(io.EOF)
+	}
+
+	result := &QueryResult{}
+	if err := it.dec.Decode(result); err != nil {
+		return nil, it.fail(err)
+	}
+
+	return result, nil
+}
+
+// Close releases the response, it is safe to call more than once
+func (it *QueryResultIterator) Close() error {
+	if it.err == nil {
+		it.err = errors.New("QueryError: iterator is closed")
+	}
+	if it.resp == nil {
+		return nil
+	}
+
+	it.body.Close()
+	err := it.resp.Body.Close()
+	it.release()
+	it.resp = nil
+	return err
+}
+
+func (it *QueryResultIterator) fail(err error) error {
+	it.Close()
+	it.err = err
+	return err
+}
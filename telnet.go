@@ -0,0 +1,156 @@
+package opentsdb
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrTelnetClosed is returned by the TelnetClient methods called after Close
+var ErrTelnetClosed = errors.New("opentsdb: telnet client closed")
+
+// TelnetClient writes points with the line based telnet protocol, e.g.
+// "put sys.cpu.user 1500000000 42 host=web01", over a single TCP connection.
+// It has less overhead than api/put but the server doesn't acknowledge the
+// points, errors are only logged on its side. The zero value is ready to
+// Connect and it is safe for concurrent use.
+type TelnetClient struct {
+	// Timeout for dialing and for each write
+	// Default: no timeout
+	Timeout time.Duration
+
+	mu     sync.Mutex
+	addr   string
+	conn   net.Conn
+	w      *bufio.Writer
+	closed bool
+}
+
+// Connect opens the connection to the TSD telnet port, e.g. "127.0.0.1:4242"
+func (t *TelnetClient) Connect(addr string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return ErrTelnetClosed
+	}
+	t.addr = addr
+	return t.connect()
+}
+
+func (t *TelnetClient) connect() error {
+	if t.conn != nil {
+		t.conn.Close()
+		t.conn = nil
+	}
+
+	conn, err := net.DialTimeout("tcp", t.addr, t.Timeout)
+	if err != nil {
+		return err
+	}
+
+	t.conn = conn
+	t.w = bufio.NewWriter(conn)
+	return nil
+}
+
+// Put writes one line per point. A broken connection is dropped and opened
+// again on the next Put, until Close is called.
+func (t *TelnetClient) Put(points []Point) error {
+	lines := make([]string, 0, len(points))
+	for _, p := range points {
+		if err := ValidatePoint(p); err != nil {
+			return err
+		}
+		if !numeric(p.Value) {
+			return fmt.Errorf("TelnetError: value %v of %s is not a number", p.Value, p.Metric)
+		}
+		lines = append(lines, telnetLine(p))
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return ErrTelnetClosed
+	}
+	if t.addr == "" {
+		return errors.New("TelnetError: Connect must be called before Put")
+	}
+	if t.conn == nil {
+		if err := t.connect(); err != nil {
+			return err
+		}
+	}
+
+	if t.Timeout > 0 {
+		t.conn.SetWriteDeadline(time.Now().Add(t.Timeout))
+	}
+
+	for _, line := range lines {
+		if _, err := t.w.WriteString(line); err != nil {
+			t.drop()
+			return err
+		}
+	}
+	if err := t.w.Flush(); err != nil {
+		t.drop()
+		return err
+	}
+
+	return nil
+}
+
+// Close closes the connection, the client can't be used anymore afterwards
+func (t *TelnetClient) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.closed = true
+	if t.conn == nil {
+		return nil
+	}
+	err := t.conn.Close()
+	t.conn = nil
+	return err
+}
+
+func (t *TelnetClient) drop() {
+	t.conn.Close()
+	t.conn = nil
+}
+
+// telnetLine formats p as a put command, tags sorted by key
+func telnetLine(p Point) string {
+	keys := make([]string, 0, len(p.Tags))
+	for k := range p.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "put %s %d %v", p.Metric, p.Timestamp, p.Value)
+	for _, k := range keys {
+		fmt.Fprintf(&b, " %s=%s", k, p.Tags[k])
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// numeric reports whether v is a value the put command accepts
+func numeric(v interface{}) bool {
+	switch n := v.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return true
+	case json.Number:
+		_, err := n.Float64()
+		return err == nil
+	}
+	return false
+}
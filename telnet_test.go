@@ -0,0 +1,91 @@
+package opentsdb_test
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/whitesmith/go-opentsdb"
+)
+
+func TestTelnetPut(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	lines := make(chan string, 2)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	var client opentsdb.TelnetClient
+	if err := client.Connect(ln.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	err = client.Put([]opentsdb.Point{
+		{Metric: "sys.cpu.user", Timestamp: 1500000000, Value: 42, Tags: map[string]string{"host": "web01", "dc": "eu"}},
+		{Metric: "sys.cpu.user", Timestamp: 1500000001, Value: float32(1.5), Tags: map[string]string{"host": "web01"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"put sys.cpu.user 1500000000 42 dc=eu host=web01",
+		"put sys.cpu.user 1500000001 1.5 host=web01",
+	} {
+		if got := <-lines; got != expected {
+			t.Error(
+				"Expected", expected,
+				"Got", got,
+			)
+		}
+	}
+}
+
+func TestTelnetPutInvalid(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	var client opentsdb.TelnetClient
+	if err := client.Connect(ln.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Expect values that aren't numbers to be rejected
+	for _, value := range []interface{}{nil, "42", true} {
+		err := client.Put([]opentsdb.Point{{Metric: "m", Timestamp: 1500000000, Value: value, Tags: map[string]string{"host": "a"}}})
+		if err == nil {
+			t.Error(
+				"Expected", "error for", value,
+				"Got", nil,
+			)
+		}
+	}
+
+	// Expect Put not to reconnect after Close
+	client.Close()
+	err = client.Put([]opentsdb.Point{{Metric: "m", Timestamp: 1500000000, Value: 1, Tags: map[string]string{"host": "a"}}})
+	if !errors.Is(err, opentsdb.ErrTelnetClosed) {
+		t.Error(
+			"Expected", opentsdb.ErrTelnetClosed,
+			"Got", err,
+		)
+	}
+}
@@ -0,0 +1,66 @@
+package opentsdb
+
+import (
+	"strconv"
+	"time"
+)
+
+// FormatTime formats t as a unix timestamp for query times, in seconds or in
+// milliseconds when t has millisecond precision
+func FormatTime(t time.Time) string {
+	ms := t.UnixNano() / int64(time.Millisecond)
+	if ms%1000 != 0 {
+		return strconv.FormatInt(ms, 10)
+	}
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+// Units of relative times, largest first
+var relativeUnits = []struct {
+	suffix string
+	d      time.Duration
+}{
+	{"w", 7 * 24 * time.Hour},
+	{"d", 24 * time.Hour},
+	{"h", time.Hour},
+	{"m", time.Minute},
+	{"s", time.Second},
+	{"ms", time.Millisecond},
+}
+
+// RelativeTime formats d as a time relative to now with the largest unit that
+// divides it, e.g. 2h gives "2h-ago" and 90m "90m-ago". d is rounded to the
+// millisecond, 0 or less gives "now".
+func RelativeTime(d time.Duration) string {
+	d = d.Round(time.Millisecond)
+	if d <= 0 {
+		return "now"
+	}
+
+	for _, u := range relativeUnits {
+		if d%u.d == 0 {
+			return strconv.FormatInt(int64(d/u.d), 10) + u.suffix + "-ago"
+		}
+	}
+	return strconv.FormatInt(int64(d/time.Millisecond), 10) + "ms-ago"
+}
+
+// SetStart sets the start time to t
+func (q *QueryParams) SetStart(t time.Time) {
+	q.Start = FormatTime(t)
+}
+
+// SetStartAgo sets the start time to d before now
+func (q *QueryParams) SetStartAgo(d time.Duration) {
+	q.Start = RelativeTime(d)
+}
+
+// SetEnd sets the end time to t
+func (q *QueryParams) SetEnd(t time.Time) {
+	q.End = FormatTime(t)
+}
+
+// SetEndAgo sets the end time to d before now
+func (q *QueryParams) SetEndAgo(d time.Duration) {
+	q.End = RelativeTime(d)
+}
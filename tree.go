@@ -0,0 +1,257 @@
+package opentsdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+type TreeRule struct {
+	TreeId int `json:"treeId,omitempty"`
+
+	// One of METRIC, METRIC_CUSTOM, TAGK, TAGK_CUSTOM or TAGV_CUSTOM
+	Type string `json:"type"`
+
+	Field         string `json:"field,omitempty"`
+	CustomField   string `json:"customField,omitempty"`
+	Regex         string `json:"regex,omitempty"`
+	RegexGroupIdx int    `json:"regexGroupIdx,omitempty"`
+	Separator     string `json:"separator,omitempty"`
+	DisplayFormat string `json:"displayFormat,omitempty"`
+	Description   string `json:"description,omitempty"`
+	Notes         string `json:"notes,omitempty"`
+	Level         int    `json:"level"`
+	Order         int    `json:"order"`
+}
+
+type Tree struct {
+	TreeId      int    `json:"treeId,omitempty"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Notes       string `json:"notes,omitempty"`
+
+	// Rules keyed by level and then by order within the level
+	Rules map[int]map[int]TreeRule `json:"rules,omitempty"`
+
+	Enabled       bool  `json:"enabled"`
+	StrictMatch   bool  `json:"strictMatch"`
+	StoreFailures bool  `json:"storeFailures"`
+	CreatedTime   int64 `json:"created,omitempty"`
+}
+
+func (c *Client) Trees() ([]Tree, error) {
+	return c.TreesContext(context.Background())
+}
+
+func (c *Client) TreesContext(ctx context.Context) ([]Tree, error) {
+
+	body, err := c.ExecRequestContext(ctx, "GET", "api/tree", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	trees := make([]Tree, 0)
+	if err := json.Unmarshal(body, &trees); err != nil {
+		return nil, err
+	}
+
+	return trees, nil
+
+}
+
+func (c *Client) GetTree(id int) (*Tree, error) {
+	return c.GetTreeContext(context.Background(), id)
+}
+
+func (c *Client) GetTreeContext(ctx context.Context, id int) (*Tree, error) {
+
+	params := url.Values{}
+	params.Set("treeid", strconv.Itoa(id))
+
+	body, err := c.execRequest(ctx, "GET", "api/tree", params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	tree := &Tree{}
+	if err := json.Unmarshal(body, tree); err != nil {
+		return nil, err
+	}
+
+	return tree, nil
+
+}
+
+func (c *Client) CreateTree(t *Tree) (*Tree, error) {
+	return c.CreateTreeContext(context.Background(), t)
+}
+
+func (c *Client) CreateTreeContext(ctx context.Context, t *Tree) (*Tree, error) {
+	if t.TreeId != 0 {
+		return nil, errors.New("TreeError: TreeId must be empty when creating a tree")
+	}
+
+	return c.postTree(ctx, t)
+}
+
+func (c *Client) UpdateTree(t *Tree) (*Tree, error) {
+	return c.UpdateTreeContext(context.Background(), t)
+}
+
+func (c *Client) UpdateTreeContext(ctx context.Context, t *Tree) (*Tree, error) {
+	if t.TreeId == 0 {
+		return nil, errors.New("TreeError: TreeId is required when updating a tree")
+	}
+
+	return c.postTree(ctx, t)
+}
+
+func (c *Client) postTree(ctx context.Context, t *Tree) (*Tree, error) {
+
+	data, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := c.ExecRequestContext(ctx, "POST", "api/tree", data)
+	if err != nil {
+		return nil, err
+	}
+
+	tree := &Tree{}
+	if err := json.Unmarshal(body, tree); err != nil {
+		return nil, err
+	}
+
+	return tree, nil
+
+}
+
+type Leaf struct {
+	Metric      string            `json:"metric"`
+	Tags        map[string]string `json:"tags"`
+	TSUID       string            `json:"tsuid"`
+	DisplayName string            `json:"displayName"`
+}
+
+type Branch struct {
+	TreeId      int               `json:"treeId"`
+	BranchId    string            `json:"branchId"`
+	Path        map[string]string `json:"path"`
+	DisplayName string            `json:"displayName"`
+	Depth       int               `json:"depth"`
+
+	// Child branches are only populated one level deep
+	Branches []Branch `json:"branches"`
+	Leaves   []Leaf   `json:"leaves"`
+}
+
+// TreeBranch fetches a single branch of a tree with its direct children.
+// An empty branchId returns the root branch of the tree.
+func (c *Client) TreeBranch(treeId int, branchId string) (*Branch, error) {
+	return c.TreeBranchContext(context.Background(), treeId, branchId)
+}
+
+func (c *Client) TreeBranchContext(ctx context.Context, treeId int, branchId string) (*Branch, error) {
+
+	params := url.Values{}
+	params.Set("treeid", strconv.Itoa(treeId))
+	if branchId != "" {
+		params.Set("branch", branchId)
+	}
+
+	body, err := c.execRequest(ctx, "GET", "api/tree/branch", params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	branch := &Branch{}
+	if err := json.Unmarshal(body, branch); err != nil {
+		return nil, err
+	}
+
+	return branch, nil
+
+}
+
+func (c *Client) SetTreeRule(treeId int, r *TreeRule) error {
+	return c.SetTreeRuleContext(context.Background(), treeId, r)
+}
+
+func (c *Client) SetTreeRuleContext(ctx context.Context, treeId int, r *TreeRule) error {
+	if r.Type == "" {
+		return errors.New("TreeError: rule Type can not be empty")
+	}
+
+	rule := *r
+	rule.TreeId = treeId
+
+	data, err := json.Marshal(rule)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.ExecRequestContext(ctx, "POST", "api/tree/rule", data)
+	return err
+}
+
+func (c *Client) DeleteTreeRule(treeId, level, order int) error {
+	return c.DeleteTreeRuleContext(context.Background(), treeId, level, order)
+}
+
+func (c *Client) DeleteTreeRuleContext(ctx context.Context, treeId, level, order int) error {
+
+	params := url.Values{}
+	params.Set("treeid", strconv.Itoa(treeId))
+	params.Set("level", strconv.Itoa(level))
+	params.Set("order", strconv.Itoa(order))
+
+	_, err := c.execRequest(ctx, "DELETE", "api/tree/rule", params.Encode(), nil)
+	return err
+}
+
+// TreeCollisions returns the TSUIDs that collided with another series when
+// the tree was built, mapped to the TSUID that took their place. An empty
+// tsuids list returns every collision.
+func (c *Client) TreeCollisions(treeId int, tsuids []string) (map[string]string, error) {
+	return c.TreeCollisionsContext(context.Background(), treeId, tsuids)
+}
+
+func (c *Client) TreeCollisionsContext(ctx context.Context, treeId int, tsuids []string) (map[string]string, error) {
+	return c.treeTSUIDReport(ctx, "api/tree/collisions", treeId, tsuids)
+}
+
+// TreeNotMatched returns the TSUIDs that did not match any rule of the tree,
+// mapped to the reason. An empty tsuids list returns every entry.
+func (c *Client) TreeNotMatched(treeId int, tsuids []string) (map[string]string, error) {
+	return c.TreeNotMatchedContext(context.Background(), treeId, tsuids)
+}
+
+func (c *Client) TreeNotMatchedContext(ctx context.Context, treeId int, tsuids []string) (map[string]string, error) {
+	return c.treeTSUIDReport(ctx, "api/tree/notmatched", treeId, tsuids)
+}
+
+func (c *Client) treeTSUIDReport(ctx context.Context, path string, treeId int, tsuids []string) (map[string]string, error) {
+
+	params := url.Values{}
+	params.Set("treeid", strconv.Itoa(treeId))
+	if len(tsuids) > 0 {
+		params.Set("tsuids", strings.Join(tsuids, ","))
+	}
+
+	body, err := c.execRequest(ctx, "GET", path, params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	report := make(map[string]string)
+	if err := json.Unmarshal(body, &report); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+
+}
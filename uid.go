@@ -0,0 +1,458 @@
+package opentsdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+func validateUIDType(utype string) error {
+	switch utype {
+	case "metric", "tagk", "tagv":
+		return nil
+	}
+	return fmt.Errorf("UIDError: type must be one of metric, tagk or tagv, got %q", utype)
+}
+
+type UIDAssignRequest struct {
+	Metric []string `json:"metric,omitempty"`
+	Tagk   []string `json:"tagk,omitempty"`
+	Tagv   []string `json:"tagv,omitempty"`
+}
+
+type UIDAssignResult struct {
+	// Successful assignments, name -> UID
+	Metric map[string]string `json:"metric,omitempty"`
+	Tagk   map[string]string `json:"tagk,omitempty"`
+	Tagv   map[string]string `json:"tagv,omitempty"`
+
+	// Failed assignments, name -> error message
+	MetricErrors map[string]string `json:"metric_errors,omitempty"`
+	TagkErrors   map[string]string `json:"tagk_errors,omitempty"`
+	TagvErrors   map[string]string `json:"tagv_errors,omitempty"`
+}
+
+// HasErrors reports whether any of the requested names failed to be assigned
+func (r *UIDAssignResult) HasErrors() bool {
+	return len(r.MetricErrors) > 0 || len(r.TagkErrors) > 0 || len(r.TagvErrors) > 0
+}
+
+// AssignUID assigns UIDs in bulk. OpenTSDB answers 400 when at least one name
+// fails, in that case the result is still returned with the per name errors
+// filled in and a nil error.
+func (c *Client) AssignUID(req *UIDAssignRequest) (*UIDAssignResult, error) {
+	return c.AssignUIDContext(context.Background(), req)
+}
+
+func (c *Client) AssignUIDContext(ctx context.Context, req *UIDAssignRequest) (*UIDAssignResult, error) {
+	if len(req.Metric) == 0 && len(req.Tagk) == 0 && len(req.Tagv) == 0 {
+		return nil, errors.New("UIDError: at least one metric, tagk or tagv is required")
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, body, err := c.doRequest(ctx, "POST", "api/uid/assign", "", data)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusBadRequest {
+		return nil, responseError(resp, body)
+	}
+
+	result := &UIDAssignResult{}
+	err = json.Unmarshal(body, result)
+	if resp.StatusCode == http.StatusBadRequest && (err != nil || !result.HasErrors()) {
+		// Not an assignment report, e.g. a malformed request
+		return nil, responseError(resp, body)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+
+}
+
+// RenameUID renames the UID of the given type from name to newName. On
+// failure the error carries the message reported by the server.
+func (c *Client) RenameUID(utype, name, newName string) error {
+	return c.RenameUIDContext(context.Background(), utype, name, newName)
+}
+
+func (c *Client) RenameUIDContext(ctx context.Context, utype, name, newName string) error {
+	if err := validateUIDType(utype); err != nil {
+		return err
+	}
+	if name == "" || newName == "" {
+		return errors.New("UIDError: name and new name can not be empty")
+	}
+
+	// OpenTSDB takes the current name under the type key, e.g.
+	// metric=old&name=new
+	params := url.Values{}
+	params.Set(utype, name)
+	params.Set("name", newName)
+
+	resp, body, err := c.doRequest(ctx, "POST", "api/uid/rename", params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 400 {
+		var result struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(body, &result) == nil && result.Error != "" {
+			return statusError(resp.StatusCode, result.Error)
+		}
+		if msg := strings.TrimSpace(string(body)); msg != "" {
+			return statusError(resp.StatusCode, msg)
+		}
+		return statusError(resp.StatusCode, resp.Status)
+	}
+
+	return nil
+}
+
+// DeleteUID removes the UID of the given type assigned to name, it requires
+// OpenTSDB 2.2. When there is no such name the returned error wraps
+// ErrNotFound, so cleanups can ignore it.
+func (c *Client) DeleteUID(utype, name string) error {
+	return c.DeleteUIDContext(context.Background(), utype, name)
+}
+
+func (c *Client) DeleteUIDContext(ctx context.Context, utype, name string) error {
+	if err := validateUIDType(utype); err != nil {
+		return err
+	}
+	if name == "" {
+		return errors.New("UIDError: name can not be empty")
+	}
+
+	params := url.Values{}
+	params.Set(utype, name)
+
+	resp, body, err := c.doRequest(ctx, "DELETE", "api/uid/assign", params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode == http.StatusBadRequest {
+		// Failures are reported like assignments, per name
+		result := &UIDAssignResult{}
+		if json.Unmarshal(body, result) == nil && result.HasErrors() {
+			errs := map[string]map[string]string{
+				"metric": result.MetricErrors,
+				"tagk":   result.TagkErrors,
+				"tagv":   result.TagvErrors,
+			}
+			if msg, ok := errs[utype][name]; ok {
+				if strings.Contains(msg, "No such") {
+					return fmt.Errorf("UIDError: %w: %s", ErrNotFound, msg)
+				}
+				return fmt.Errorf("UIDError: %s", msg)
+			}
+		}
+	}
+
+	if resp.StatusCode >= 400 {
+		return responseError(resp, body)
+	}
+
+	return nil
+}
+
+type UIDMeta struct {
+	UID string `json:"uid"`
+
+	// One of metric, tagk or tagv, the server reports it upper cased
+	Type string `json:"type"`
+
+	Name        string            `json:"name,omitempty"`
+	DisplayName string            `json:"displayName,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Notes       string            `json:"notes,omitempty"`
+	Created     int64             `json:"created,omitempty"`
+	Custom      map[string]string `json:"custom,omitempty"`
+}
+
+func (c *Client) GetUIDMeta(utype, uid string) (*UIDMeta, error) {
+	return c.GetUIDMetaContext(context.Background(), utype, uid)
+}
+
+func (c *Client) GetUIDMetaContext(ctx context.Context, utype, uid string) (*UIDMeta, error) {
+	if err := validateUIDType(utype); err != nil {
+		return nil, err
+	}
+	if uid == "" {
+		return nil, errors.New("UIDError: uid can not be empty")
+	}
+
+	params := url.Values{}
+	params.Set("uid", uid)
+	params.Set("type", utype)
+
+	body, err := c.execRequest(ctx, "GET", "api/uid/uidmeta", params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &UIDMeta{}
+	if err := json.Unmarshal(body, meta); err != nil {
+		return nil, err
+	}
+
+	return meta, nil
+
+}
+
+// UpdateUIDMeta stores the fields set on m, fields left empty are untouched
+// on the server. The updated meta data is returned.
+func (c *Client) UpdateUIDMeta(m *UIDMeta) (*UIDMeta, error) {
+	return c.UpdateUIDMetaContext(context.Background(), m)
+}
+
+func (c *Client) UpdateUIDMetaContext(ctx context.Context, m *UIDMeta) (*UIDMeta, error) {
+	if err := validateUIDType(strings.ToLower(m.Type)); err != nil {
+		return nil, err
+	}
+	if m.UID == "" {
+		return nil, errors.New("UIDError: uid can not be empty")
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := c.ExecRequestContext(ctx, "POST", "api/uid/uidmeta", data)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &UIDMeta{}
+	if err := json.Unmarshal(body, meta); err != nil {
+		return nil, err
+	}
+
+	return meta, nil
+
+}
+
+// MetaFloat is a float that also decodes the "NaN" string OpenTSDB emits for
+// unset TSMeta bounds
+type MetaFloat float64
+
+func (f MetaFloat) MarshalJSON() ([]byte, error) {
+	if math.IsNaN(float64(f)) {
+		return []byte(`"NaN"`), nil
+	}
+	return json.Marshal(float64(f))
+}
+
+func (f *MetaFloat) UnmarshalJSON(data []byte) error {
+	var s string
+	if json.Unmarshal(data, &s) == nil {
+		if s == "NaN" || s == "" {
+			*f = MetaFloat(math.NaN())
+			return nil
+		}
+		data = []byte(s)
+	}
+
+	var v float64
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*f = MetaFloat(v)
+	return nil
+}
+
+type TSMeta struct {
+	TSUID string `json:"tsuid"`
+
+	// Meta data of the metric and tags, filled in by the server
+	Metric UIDMeta   `json:"metric"`
+	Tags   []UIDMeta `json:"tags,omitempty"`
+
+	DisplayName string            `json:"displayName,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Notes       string            `json:"notes,omitempty"`
+	Created     int64             `json:"created,omitempty"`
+	Units       string            `json:"units,omitempty"`
+	DataType    string            `json:"dataType,omitempty"`
+	Retention   int               `json:"retention,omitempty"`
+	Max         MetaFloat         `json:"max,omitempty"`
+	Min         MetaFloat         `json:"min,omitempty"`
+	Custom      map[string]string `json:"custom,omitempty"`
+
+	LastReceived    int64 `json:"lastReceived,omitempty"`
+	TotalDatapoints int64 `json:"totalDatapoints,omitempty"`
+}
+
+func (c *Client) GetTSMeta(tsuid string) (*TSMeta, error) {
+	return c.GetTSMetaContext(context.Background(), tsuid)
+}
+
+func (c *Client) GetTSMetaContext(ctx context.Context, tsuid string) (*TSMeta, error) {
+	if tsuid == "" {
+		return nil, errors.New("UIDError: tsuid can not be empty")
+	}
+
+	params := url.Values{}
+	params.Set("tsuid", tsuid)
+
+	body, err := c.execRequest(ctx, "GET", "api/uid/tsmeta", params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &TSMeta{}
+	if err := json.Unmarshal(body, meta); err != nil {
+		return nil, err
+	}
+
+	return meta, nil
+
+}
+
+func (c *Client) CreateTSMeta(m *TSMeta) (*TSMeta, error) {
+	return c.CreateTSMetaContext(context.Background(), m)
+}
+
+func (c *Client) CreateTSMetaContext(ctx context.Context, m *TSMeta) (*TSMeta, error) {
+	if m.TSUID == "" {
+		return nil, errors.New("UIDError: tsuid can not be empty")
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := c.ExecRequestContext(ctx, "POST", "api/uid/tsmeta", data)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &TSMeta{}
+	if err := json.Unmarshal(body, meta); err != nil {
+		return nil, err
+	}
+
+	return meta, nil
+
+}
+
+func (c *Client) DeleteTSMeta(tsuid string) error {
+	return c.DeleteTSMetaContext(context.Background(), tsuid)
+}
+
+func (c *Client) DeleteTSMetaContext(ctx context.Context, tsuid string) error {
+	if tsuid == "" {
+		return errors.New("UIDError: tsuid can not be empty")
+	}
+
+	data, err := json.Marshal(map[string]string{"tsuid": tsuid})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.ExecRequestContext(ctx, "DELETE", "api/uid/tsmeta", data)
+	return err
+}
+
+// UIDRef identifies a UID to look up with GetUIDMetas
+type UIDRef struct {
+	// One of metric, tagk or tagv
+	Type string
+	UID  string
+}
+
+// Number of lookups GetUIDMetas runs at once
+const uidMetaConcurrency = 8
+
+// UIDMetaErrors is the error of GetUIDMetas when some lookups failed
+type UIDMetaErrors struct {
+	// Error of each lookup, in the order of the refs, nil when it succeeded
+	Errs []error
+}
+
+func (e *UIDMetaErrors) Error() string {
+	failed := 0
+	for _, err := range e.Errs {
+		if err != nil {
+			failed++
+		}
+	}
+	return fmt.Sprintf("UIDError: %d of %d lookups failed", failed, len(e.Errs))
+}
+
+// Unwrap makes errors.Is and errors.As match the errors of the lookups
+func (e *UIDMetaErrors) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errs))
+	for _, err := range e.Errs {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// GetUIDMetas looks up the meta data of several UIDs concurrently with
+// GetUIDMeta. The metas are returned in the order of refs, the ones that
+// failed are left empty and the error is then a *UIDMetaErrors.
+func (c *Client) GetUIDMetas(refs []UIDRef) ([]UIDMeta, error) {
+	return c.GetUIDMetasContext(context.Background(), refs)
+}
+
+func (c *Client) GetUIDMetasContext(ctx context.Context, refs []UIDRef) ([]UIDMeta, error) {
+	metas := make([]UIDMeta, len(refs))
+	errs := make([]error, len(refs))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < uidMetaConcurrency && w < len(refs); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				meta, err := c.GetUIDMetaContext(ctx, refs[i].Type, refs[i].UID)
+				if err != nil {
+					errs[i] = err
+					continue
+				}
+				metas[i] = *meta
+			}
+		}()
+	}
+
+	// Once ctx is done the lookups not sent yet fail with its error
+	for i := range refs {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			errs[i] = ctx.Err()
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return metas, &UIDMetaErrors{Errs: errs}
+		}
+	}
+
+	return metas, nil
+}
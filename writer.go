@@ -0,0 +1,177 @@
+package opentsdb
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrWriterClosed is returned by the Writer methods called after Close
+var ErrWriterClosed = errors.New("opentsdb: writer closed")
+
+type WriterOptions struct {
+	// Number of buffered points that triggers a flush
+	// Default: 1000
+	BatchSize int
+
+	// Maximum time points stay buffered before being flushed
+	// Default: 1s
+	FlushInterval time.Duration
+
+	// Capacity of the Errors channel, errors are dropped when it's full
+	// Default: 64
+	ErrorBuffer int
+
+	// Timestamps of the added points are unix milliseconds
+	MillisecondTimestamps bool
+}
+
+// Writer buffers points and sends them with Put in the background, whenever
+// BatchSize points are buffered or FlushInterval elapsed. It is safe for
+// concurrent use.
+type Writer struct {
+	client *Client
+	opts   WriterOptions
+
+	mu     sync.Mutex
+	points []*Point
+	closed bool
+
+	full    chan struct{}
+	flushes chan chan error
+	errors  chan error
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func (c *Client) NewWriter(opts WriterOptions) *Writer {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 1000
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+	if opts.ErrorBuffer <= 0 {
+		opts.ErrorBuffer = 64
+	}
+
+	w := &Writer{
+		client:  c,
+		opts:    opts,
+		full:    make(chan struct{}, 1),
+		flushes: make(chan chan error),
+		errors:  make(chan error, opts.ErrorBuffer),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	go w.run()
+
+	return w
+}
+
+// Add buffers p, it is checked with ValidatePoint first
+func (w *Writer) Add(p Point) error {
+	if err := ValidatePoint(p); err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return ErrWriterClosed
+	}
+	w.points = append(w.points, &p)
+	full := len(w.points) >= w.opts.BatchSize
+	w.mu.Unlock()
+
+	if full {
+		select {
+		case w.full <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// Flush sends the buffered points and waits for the requests to finish. It
+// returns the errors of the Puts, which are delivered on Errors as well.
+func (w *Writer) Flush() error {
+	done := make(chan error, 1)
+	select {
+	case w.flushes <- done:
+		return <-done
+	case <-w.stopped:
+		return ErrWriterClosed
+	}
+}
+
+// Close flushes the buffered points, stops the background goroutine and
+// closes the Errors channel
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return ErrWriterClosed
+	}
+	w.closed = true
+	w.mu.Unlock()
+
+	close(w.done)
+	<-w.stopped
+	return nil
+}
+
+// Errors delivers the errors of the background Puts
+func (w *Writer) Errors() <-chan error {
+	return w.errors
+}
+
+func (w *Writer) run() {
+	defer close(w.stopped)
+	defer close(w.errors)
+
+	ticker := time.NewTicker(w.opts.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.flush()
+		case <-w.full:
+			w.flush()
+		case done := <-w.flushes:
+			done <- w.flush()
+		case <-w.done:
+			w.flush()
+			return
+		}
+	}
+}
+
+func (w *Writer) flush() error {
+	w.mu.Lock()
+	points := w.points
+	w.points = nil
+	w.mu.Unlock()
+
+	var errs []error
+	for len(points) > 0 {
+		n := w.opts.BatchSize
+		if n > len(points) {
+			n = len(points)
+		}
+
+		if _, err := w.client.Put(&BatchPoints{Points: points[:n], MillisecondTimestamps: w.opts.MillisecondTimestamps}, ""); err != nil {
+			errs = append(errs, err)
+			select {
+			case w.errors <- err:
+			default:
+			}
+		}
+		points = points[n:]
+	}
+
+	return errors.Join(errs...)
+}
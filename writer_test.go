@@ -0,0 +1,93 @@
+package opentsdb_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/whitesmith/go-opentsdb"
+)
+
+func TestWriter(t *testing.T) {
+	var mu sync.Mutex
+	var batches []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var points []opentsdb.Point
+		json.NewDecoder(r.Body).Decode(&points)
+		mu.Lock()
+		batches = append(batches, len(points))
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+	writer := client.NewWriter(opentsdb.WriterOptions{BatchSize: 2, FlushInterval: time.Hour})
+
+	for i := 0; i < 3; i++ {
+		err := writer.Add(opentsdb.Point{Metric: "metric", Timestamp: int64(1500000000 + i), Value: i, Tags: map[string]string{"host": "a"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	total := 0
+	for _, n := range batches {
+		if n > 2 {
+			t.Error(
+				"Expected", "batches of at most 2 points",
+				"Got", batches,
+			)
+		}
+		total += n
+	}
+	if total != 3 {
+		t.Error(
+			"Expected", 3,
+			"Got", total,
+		)
+	}
+
+	if err := writer.Add(opentsdb.Point{Metric: "metric", Value: 1, Tags: map[string]string{"host": "a"}}); err != opentsdb.ErrWriterClosed {
+		t.Error(
+			"Expected", opentsdb.ErrWriterClosed,
+			"Got", err,
+		)
+	}
+}
+
+func TestWriterErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	client, _ := opentsdb.NewClient(opentsdb.Options{Endpoint: server.URL})
+	writer := client.NewWriter(opentsdb.WriterOptions{})
+
+	writer.Add(opentsdb.Point{Metric: "metric", Timestamp: 1500000000, Value: 1, Tags: map[string]string{"host": "a"}})
+	if err := writer.Flush(); err == nil {
+		t.Error("Expected", "error from Flush", "Got", nil)
+	}
+
+	select {
+	case err := <-writer.Errors():
+		if err == nil {
+			t.Error("Expected", "error", "Got", nil)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected", "error", "Got", "timeout")
+	}
+
+	writer.Close()
+	if _, ok := <-writer.Errors(); ok {
+		t.Error("Expected", "closed channel", "Got", "open channel")
+	}
+}